@@ -0,0 +1,62 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"io"
+)
+
+// Checksum algorithms understood by ClawIO. ChecksumNone disables
+// checksums.
+const (
+	ChecksumMD5     = "md5"
+	ChecksumSHA1    = "sha1"
+	ChecksumAdler32 = "adler32"
+	ChecksumNone    = "none"
+)
+
+// NewHash returns the hash computing checksums with algo. It returns nil if
+// algo is ChecksumNone or empty.
+func NewHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil
+	case ChecksumAdler32:
+		return adler32.New(), nil
+	case ChecksumNone, "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("invalid checksum algorithm %q: it must be md5, sha1, adler32 or none", algo)
+}
+
+// Checksum returns the checksum of the content of r in the "algo:value"
+// form used by ClawIO, or the empty string if algo is ChecksumNone.
+func Checksum(algo string, r io.Reader) (string, error) {
+	h, err := NewHash(algo)
+	if err != nil || h == nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%x", algo, h.Sum(nil)), nil
+}
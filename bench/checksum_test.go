@@ -0,0 +1,71 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		algo string
+		in   string
+		want string
+	}{
+		{ChecksumMD5, "hello world", "md5:5eb63bbbe01eeed093cb22bb8f5acdc3"},
+		{ChecksumMD5, "", "md5:d41d8cd98f00b204e9800998ecf8427e"},
+		{ChecksumSHA1, "hello world", "sha1:2aae6c35c94fcfb415dbe95f408b9ce91ee846ed"},
+		{ChecksumSHA1, "", "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{ChecksumAdler32, "hello world", "adler32:1a0b045d"},
+		{ChecksumAdler32, "", "adler32:00000001"},
+		{ChecksumNone, "hello world", ""},
+		{"", "hello world", ""},
+	}
+	for _, tt := range tests {
+		got, err := Checksum(tt.algo, strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("Checksum(%q, %q) returned error %v", tt.algo, tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Checksum(%q, %q) = %q, want %q", tt.algo, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewHash(t *testing.T) {
+	for _, algo := range []string{ChecksumMD5, ChecksumSHA1, ChecksumAdler32} {
+		if h, err := NewHash(algo); err != nil || h == nil {
+			t.Errorf("NewHash(%q) = %v, %v, want a hash", algo, h, err)
+		}
+	}
+	for _, algo := range []string{ChecksumNone, ""} {
+		if h, err := NewHash(algo); err != nil || h != nil {
+			t.Errorf("NewHash(%q) = %v, %v, want no hash", algo, h, err)
+		}
+	}
+}
+
+func TestChecksumUnknownAlgorithm(t *testing.T) {
+	for _, algo := range []string{"sha256", "MD5", "crc32"} {
+		if _, err := NewHash(algo); err == nil {
+			t.Errorf("NewHash(%q) returned no error", algo)
+		}
+		if got, err := Checksum(algo, strings.NewReader("hello world")); err == nil {
+			t.Errorf("Checksum(%q) = %q, want an error", algo, got)
+		}
+	}
+}
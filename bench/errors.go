@@ -0,0 +1,100 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"net"
+	"net/url"
+)
+
+// Error classes used by ClassifyError.
+const (
+	ErrorTimeout    = "timeout"
+	ErrorConnection = "connection"
+	ErrorOther      = "other"
+	// ErrorIntegrity is the class of the errors of probes whose request
+	// succeeded but transferred data that does not match what was expected.
+	ErrorIntegrity = "integrity"
+)
+
+// Classifier is implemented by errors that know their own class, like
+// the errors for unexpected HTTP status codes.
+type Classifier interface {
+	Class() string
+}
+
+// TimeoutError is returned for probes that did not complete within the
+// timeout of the Runner.
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout: " + e.Err.Error()
+}
+
+// Class returns ErrorTimeout.
+func (e *TimeoutError) Class() string {
+	return ErrorTimeout
+}
+
+// ErrorClass counts the failed probes of a class and keeps the message of
+// the first one as a sample.
+type ErrorClass struct {
+	Count  int
+	Sample string
+}
+
+// ClassifyError returns the class of a probe error: the class given by the
+// error itself if it implements Classifier, ErrorTimeout, the gRPC status
+// code prefixed with "grpc:", ErrorConnection or ErrorOther.
+func ClassifyError(err error) string {
+	if c, ok := err.(Classifier); ok {
+		return c.Class()
+	}
+	if err == context.DeadlineExceeded {
+		return ErrorTimeout
+	}
+
+	switch code := grpc.Code(err); code {
+	case codes.Unknown:
+		// grpc.Code also returns codes.Unknown for the errors that do not
+		// come from gRPC, whose description is their whole message
+		if grpc.ErrorDesc(err) != err.Error() {
+			return "grpc:" + code.String()
+		}
+	case codes.DeadlineExceeded:
+		return ErrorTimeout
+	default:
+		return "grpc:" + code.String()
+	}
+
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if nerr, ok := err.(net.Error); ok {
+		if nerr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorConnection
+	}
+	if _, ok := err.(*net.OpError); ok {
+		return ErrorConnection
+	}
+	return ErrorOther
+}
@@ -0,0 +1,68 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"net"
+	"net/url"
+	"testing"
+)
+
+// netError is a net.Error with a configurable timeout.
+type netError struct {
+	timeout bool
+}
+
+func (e netError) Error() string   { return "net error" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return false }
+
+// classError is an error that knows its own class.
+type classError string
+
+func (e classError) Error() string { return string(e) }
+func (e classError) Class() string { return string(e) }
+
+func TestClassifyError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&TimeoutError{Err: errors.New("slow")}, ErrorTimeout},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{grpc.Errorf(codes.DeadlineExceeded, "slow"), ErrorTimeout},
+		{grpc.Errorf(codes.Unavailable, "down"), "grpc:Unavailable"},
+		{grpc.Errorf(codes.Unauthenticated, "bad token"), "grpc:Unauthenticated"},
+		{grpc.Errorf(codes.Internal, "boom"), "grpc:Internal"},
+		{grpc.Errorf(codes.Unknown, "boom"), "grpc:Unknown"},
+		{refused, ErrorConnection},
+		{&url.Error{Op: "Put", URL: "http://localhost", Err: refused}, ErrorConnection},
+		{&url.Error{Op: "Get", URL: "http://localhost", Err: netError{timeout: true}}, ErrorTimeout},
+		{netError{timeout: false}, ErrorConnection},
+		{classError("http:507"), "http:507"},
+		{classError(ErrorIntegrity), ErrorIntegrity},
+		{errors.New("something else"), ErrorOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%#v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"math"
+	"time"
+)
+
+// subBucketBits controls the precision of the histogram. Every power of two
+// range is split into 2^(subBucketBits-1) linear sub buckets, which keeps
+// the relative error of any recorded value below 1%.
+const subBucketBits = 8
+
+const subBucketHalf = 1 << (subBucketBits - 1)
+
+// Histogram records durations in log-linear buckets in the same fashion as
+// an HDR histogram: the memory needed is fixed by the precision and not by
+// the number of recorded values.
+type Histogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    float64
+	sumSq  float64
+}
+
+// NewHistogram returns an empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func bucketIndex(v int64) int {
+	b := 0
+	for (v >> uint(b)) >= 2*subBucketHalf {
+		b++
+	}
+	if b == 0 {
+		return int(v)
+	}
+	return b*subBucketHalf + int(v>>uint(b))
+}
+
+// bucketValue returns the highest value that falls into the bucket idx.
+func bucketValue(idx int) int64 {
+	if idx < 2*subBucketHalf {
+		return int64(idx)
+	}
+	b := idx/subBucketHalf - 1
+	sub := int64(idx - b*subBucketHalf)
+	return (sub+1)<<uint(b) - 1
+}
+
+// Record adds d to the histogram. Negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+
+	idx := bucketIndex(v)
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+}
+
+// Merge adds all the values recorded in o to the histogram.
+func (h *Histogram) Merge(o *Histogram) {
+	if o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+	h.sumSq += o.sumSq
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min)
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+// Mean returns the arithmetic mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+// StdDev returns the population standard deviation of the recorded values.
+func (h *Histogram) StdDev() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.total)
+	variance := h.sumSq/float64(h.total) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance))
+}
+
+// Percentile returns the value below which q percent of the recorded values
+// fall. q is expressed in the range [0, 100].
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if q > 100 {
+		q = 100
+	}
+	target := int64(math.Ceil(q / 100 * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			v := bucketValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
@@ -0,0 +1,130 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketIndexExactBelowSubBuckets(t *testing.T) {
+	for v := int64(0); v < 2*subBucketHalf; v++ {
+		idx := bucketIndex(v)
+		if got := bucketValue(idx); got != v {
+			t.Errorf("bucketValue(bucketIndex(%d)) = %d, want %d", v, got, v)
+		}
+	}
+}
+
+func TestBucketRelativeError(t *testing.T) {
+	values := []int64{
+		255, 256, 257, 511, 512, 1000, 1023, 1024, 4097,
+		int64(time.Microsecond), int64(1234567), int64(time.Millisecond),
+		int64(999 * time.Millisecond), int64(time.Second), int64(time.Minute),
+		int64(time.Hour), 1<<40 + 12345,
+	}
+	for _, v := range values {
+		idx := bucketIndex(v)
+		hi := bucketValue(idx)
+		if hi < v {
+			t.Errorf("bucketValue(bucketIndex(%d)) = %d, below the value", v, hi)
+		}
+		if idx > 0 && bucketValue(idx-1) >= v {
+			t.Errorf("value %d also fits in the previous bucket %d", v, idx-1)
+		}
+		if err := float64(hi-v) / float64(v); err >= 0.01 {
+			t.Errorf("relative error of %d is %.4f, want below 0.01", v, err)
+		}
+	}
+}
+
+func TestBucketIndexMonotonic(t *testing.T) {
+	prev := bucketIndex(0)
+	for v := int64(1); v < 1<<20; v += 7 {
+		idx := bucketIndex(v)
+		if idx < prev {
+			t.Fatalf("bucketIndex(%d) = %d, below bucketIndex of a smaller value %d", v, idx, prev)
+		}
+		prev = idx
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{99.9, 999 * time.Millisecond},
+		{100, 1000 * time.Millisecond},
+		{150, 1000 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := h.Percentile(tt.q)
+		if got < tt.want || float64(got-tt.want)/float64(tt.want) >= 0.01 {
+			t.Errorf("Percentile(%v) = %v, want %v within 1%%", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPercentileClampedToRecordedRange(t *testing.T) {
+	h := NewHistogram()
+	h.Record(1234567 * time.Nanosecond)
+	for _, q := range []float64{0, 50, 100} {
+		if got := h.Percentile(q); got != 1234567*time.Nanosecond {
+			t.Errorf("Percentile(%v) = %v, want the only recorded value", q, got)
+		}
+	}
+}
+
+func TestHistogramStats(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(50) != 0 || h.Mean() != 0 || h.StdDev() != 0 {
+		t.Errorf("empty histogram does not report zero")
+	}
+
+	for _, d := range []time.Duration{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.Record(d * time.Millisecond)
+	}
+	h.Record(-time.Second)
+
+	if got := h.Count(); got != 9 {
+		t.Errorf("Count() = %d, want 9", got)
+	}
+	if got := h.Min(); got != 0 {
+		t.Errorf("Min() = %v, want 0 for a negative duration", got)
+	}
+	if got := h.Max(); got != 9*time.Millisecond {
+		t.Errorf("Max() = %v, want 9ms", got)
+	}
+
+	o := NewHistogram()
+	o.Record(20 * time.Millisecond)
+	h.Merge(o)
+	if h.Count() != 10 || h.Max() != 20*time.Millisecond {
+		t.Errorf("Merge: Count() = %d, Max() = %v, want 10 and 20ms", h.Count(), h.Max())
+	}
+	if got := h.Mean(); got != 60*time.Millisecond/10 {
+		t.Errorf("Mean() = %v, want 6ms", got)
+	}
+}
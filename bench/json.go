@@ -0,0 +1,164 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONReporter writes the result of the run to W as a JSON document.
+// Metadata is included as is, and the values of the Extra columns are
+// included for every row.
+type JSONReporter struct {
+	W        io.Writer
+	Metadata interface{}
+	Extra    []Column
+}
+
+type jsonReport struct {
+	Metadata    interface{}   `json:"metadata,omitempty"`
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Interrupted bool          `json:"interrupted"`
+	Phases      []*jsonResult `json:"phases"`
+}
+
+type jsonResult struct {
+	Phase       string                `json:"phase"`
+	Op          string                `json:"op,omitempty"`
+	Bucket      string                `json:"bucket,omitempty"`
+	Requests    int                   `json:"requests"`
+	Concurrency int                   `json:"concurrency"`
+	Failed      int                   `json:"failed"`
+	Missed      int                   `json:"missed"`
+	Start       time.Time             `json:"start"`
+	End         time.Time             `json:"end"`
+	Duration    float64               `json:"duration"`
+	Frequency   float64               `json:"frequency"`
+	Bytes       int64                 `json:"bytes"`
+	Throughput  float64               `json:"throughput"`
+	Latency     *jsonHistogram        `json:"latency"`
+	TTFB        *jsonHistogram        `json:"ttfb,omitempty"`
+	Verify      *jsonHistogram        `json:"verify,omitempty"`
+	Errors      map[string]*jsonError `json:"errors,omitempty"`
+	Extra       map[string]string     `json:"extra,omitempty"`
+	Ops         []*jsonResult         `json:"ops,omitempty"`
+	Buckets     []*jsonResult         `json:"buckets,omitempty"`
+}
+
+type jsonError struct {
+	Count  int    `json:"count"`
+	Sample string `json:"sample"`
+}
+
+// jsonHistogram holds the statistics of a histogram. Times are in seconds.
+type jsonHistogram struct {
+	Count  int64   `json:"count"`
+	Min    float64 `json:"min"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	P999   float64 `json:"p99.9"`
+	Max    float64 `json:"max"`
+}
+
+func newJSONHistogram(h *Histogram) *jsonHistogram {
+	return &jsonHistogram{
+		Count:  h.Count(),
+		Min:    h.Min().Seconds(),
+		Mean:   h.Mean().Seconds(),
+		StdDev: h.StdDev().Seconds(),
+		P50:    h.Percentile(50).Seconds(),
+		P90:    h.Percentile(90).Seconds(),
+		P99:    h.Percentile(99).Seconds(),
+		P999:   h.Percentile(99.9).Seconds(),
+		Max:    h.Max().Seconds(),
+	}
+}
+
+func (j *JSONReporter) newJSONResult(res *Result) *jsonResult {
+	r := &jsonResult{
+		Phase:       res.Phase,
+		Op:          res.Op,
+		Bucket:      res.Bucket,
+		Requests:    res.Requests,
+		Concurrency: res.Concurrency,
+		Failed:      res.Failed,
+		Missed:      res.Missed,
+		Start:       res.Start,
+		End:         res.End(),
+		Duration:    res.Duration.Seconds(),
+		Frequency:   res.Frequency(),
+		Bytes:       res.Bytes,
+		Throughput:  res.Throughput(),
+		Latency:     newJSONHistogram(res.Latency),
+	}
+	if res.TTFB.Count() > 0 {
+		r.TTFB = newJSONHistogram(res.TTFB)
+	}
+	if res.Verify.Count() > 0 {
+		r.Verify = newJSONHistogram(res.Verify)
+	}
+	if len(res.Errors) > 0 {
+		r.Errors = map[string]*jsonError{}
+		for name, e := range res.Errors {
+			r.Errors[name] = &jsonError{Count: e.Count, Sample: e.Sample}
+		}
+	}
+	if len(j.Extra) > 0 {
+		r.Extra = map[string]string{}
+		for _, c := range j.Extra {
+			r.Extra[c.Name] = c.Value(res)
+		}
+	}
+	for _, name := range res.OpNames() {
+		r.Ops = append(r.Ops, j.newJSONResult(res.Ops[name]))
+	}
+	for _, name := range res.BucketNames() {
+		r.Buckets = append(r.Buckets, j.newJSONResult(res.Buckets[name]))
+	}
+	return r
+}
+
+// Start does nothing.
+func (j *JSONReporter) Start(r *Runner) {}
+
+// Report does nothing.
+func (j *JSONReporter) Report(sample Sample) {}
+
+// Finish writes the JSON document.
+func (j *JSONReporter) Finish(res *Result) error {
+	phases := res.Phases()
+	report := &jsonReport{
+		Metadata:    j.Metadata,
+		Start:       phases[0].Start,
+		End:         res.End(),
+		Interrupted: res.Interrupted,
+	}
+	for _, phase := range phases {
+		report.Phases = append(report.Phases, j.newJSONResult(phase))
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = j.W.Write(append(data, '\n'))
+	return err
+}
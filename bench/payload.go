@@ -0,0 +1,128 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// Kinds of payload content.
+const (
+	// PayloadConstant is made of the character "1" repeated.
+	PayloadConstant = "constant"
+	// PayloadRandom is pseudo-random and does not compress.
+	PayloadRandom = "random"
+	// PayloadCompressible mixes constant and pseudo-random content in
+	// every block of PayloadBlock bytes.
+	PayloadCompressible = "compressible"
+)
+
+// PayloadBlock is the size of the blocks of compressible payloads.
+const PayloadBlock = 4096
+
+// Payload is synthetic content of known size that is generated while it is
+// read, so large objects can be uploaded without creating local files.
+// Readers of the same payload yield the same content.
+type Payload struct {
+	Kind string
+	Size int64
+	// Seed seeds the pseudo-random content.
+	Seed int64
+	// Ratio is the fraction of constant content of compressible payloads,
+	// between 0 and 1.
+	Ratio float64
+}
+
+// CheckPayloadKind returns an error if kind is not a kind of payload.
+func CheckPayloadKind(kind string) error {
+	switch kind {
+	case PayloadConstant, PayloadRandom, PayloadCompressible:
+		return nil
+	}
+	return fmt.Errorf("invalid payload %q: it must be constant, random or compressible", kind)
+}
+
+// Reader returns a reader of the content of the payload.
+func (p Payload) Reader() io.Reader {
+	constant := int64(0)
+	switch p.Kind {
+	case PayloadRandom:
+	case PayloadCompressible:
+		ratio := p.Ratio
+		if ratio < 0 {
+			ratio = 0
+		} else if ratio > 1 {
+			ratio = 1
+		}
+		constant = int64(ratio * PayloadBlock)
+	default:
+		constant = PayloadBlock
+	}
+	return &payloadReader{
+		rnd:      rand.New(rand.NewSource(p.Seed)),
+		left:     p.Size,
+		constant: constant,
+	}
+}
+
+// payloadReader generates the content of a payload. Every block of
+// PayloadBlock bytes starts with constant bytes of constant content and is
+// filled up with pseudo-random content.
+type payloadReader struct {
+	rnd      *rand.Rand
+	left     int64
+	off      int64
+	constant int64
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := r.off % PayloadBlock
+		var end int64
+		if pos < r.constant {
+			end = r.constant
+		} else {
+			end = PayloadBlock
+		}
+		m := int(end - pos)
+		if m > len(p)-n {
+			m = len(p) - n
+		}
+
+		chunk := p[n : n+m]
+		if pos < r.constant {
+			for i := range chunk {
+				chunk[i] = '1'
+			}
+		} else {
+			r.rnd.Read(chunk)
+		}
+		n += m
+		r.off += int64(m)
+	}
+
+	r.left -= int64(n)
+	return n, nil
+}
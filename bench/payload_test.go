@@ -0,0 +1,95 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// content reads the whole content of p.
+func content(t *testing.T, p Payload) []byte {
+	b, err := ioutil.ReadAll(p.Reader())
+	if err != nil {
+		t.Fatalf("reading %+v: %s", p, err)
+	}
+	return b
+}
+
+func TestPayloadSameSeed(t *testing.T) {
+	for _, kind := range []string{PayloadConstant, PayloadRandom, PayloadCompressible} {
+		p := Payload{Kind: kind, Size: 3*PayloadBlock + 100, Seed: 42, Ratio: 0.5}
+		if !bytes.Equal(content(t, p), content(t, p)) {
+			t.Errorf("%s payloads with the same seed have different content", kind)
+		}
+	}
+
+	p := Payload{Kind: PayloadRandom, Size: PayloadBlock, Seed: 1}
+	q := p
+	q.Seed = 2
+	if bytes.Equal(content(t, p), content(t, q)) {
+		t.Error("random payloads with different seeds have the same content")
+	}
+}
+
+func TestPayloadSize(t *testing.T) {
+	for _, kind := range []string{PayloadConstant, PayloadRandom, PayloadCompressible} {
+		for _, size := range []int64{0, 1, PayloadBlock - 1, PayloadBlock, 10000} {
+			p := Payload{Kind: kind, Size: size, Ratio: 0.5}
+			if n := int64(len(content(t, p))); n != size {
+				t.Errorf("%s payload of size %d yields %d bytes", kind, size, n)
+			}
+		}
+	}
+}
+
+func TestPayloadCompressibleRatio(t *testing.T) {
+	tests := []struct {
+		kind  string
+		ratio float64
+		// constant is the number of constant bytes at the start of
+		// every block
+		constant int
+	}{
+		{PayloadConstant, 0, PayloadBlock},
+		{PayloadRandom, 0, 0},
+		{PayloadCompressible, 0, 0},
+		{PayloadCompressible, 0.25, PayloadBlock / 4},
+		{PayloadCompressible, 0.5, PayloadBlock / 2},
+		{PayloadCompressible, 1, PayloadBlock},
+		{PayloadCompressible, 2, PayloadBlock},
+	}
+	const blocks = 16
+	for _, tt := range tests {
+		b := content(t, Payload{Kind: tt.kind, Size: blocks * PayloadBlock, Seed: 7, Ratio: tt.ratio})
+		repeated := 0
+		for i := 0; i < blocks; i++ {
+			block := b[i*PayloadBlock : (i+1)*PayloadBlock]
+			if !bytes.Equal(block[:tt.constant], bytes.Repeat([]byte("1"), tt.constant)) {
+				t.Errorf("%s payload with ratio %v: block %d does not start with %d constant bytes", tt.kind, tt.ratio, i, tt.constant)
+				break
+			}
+			repeated += bytes.Count(block, []byte("1"))
+		}
+
+		// the pseudo-random content has a "1" every 256 bytes on average
+		share := float64(repeated) / float64(len(b))
+		want := float64(tt.constant) / PayloadBlock
+		if share < want || share > want+(1-want)/128 {
+			t.Errorf("%s payload with ratio %v has %.3f of repeated content, want %.3f", tt.kind, tt.ratio, share, want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/cheggaaa/pb"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Reporter is notified about the progress of a benchmark run.
+type Reporter interface {
+	// Start is called once before any probe is executed.
+	Start(r *Runner)
+	// Report is called after every probe with its outcome.
+	Report(s Sample)
+	// Finish is called once with the result of the run.
+	Finish(res *Result) error
+}
+
+// ProgressReporter draws a progress bar on the standard error, which keeps
+// the standard output for the results. For runs limited by time the bar
+// shows the elapsed seconds instead of the finished probes. Only the
+// measured phase is tracked.
+type ProgressReporter struct {
+	bar     *pb.ProgressBar
+	timed   bool
+	started bool
+	done    chan struct{}
+}
+
+// Start starts the progress bar.
+func (p *ProgressReporter) Start(r *Runner) {
+	if r.Duration <= 0 {
+		p.bar = pb.New(r.Requests)
+	} else {
+		p.timed = true
+		p.done = make(chan struct{})
+		p.bar = pb.New(int(r.Duration.Seconds()))
+		p.bar.ShowCounters = false
+	}
+	p.bar.Output = os.Stderr
+	p.bar.Start()
+}
+
+// Report increments the progress bar.
+func (p *ProgressReporter) Report(sample Sample) {
+	if sample.Phase != PhaseMeasure {
+		return
+	}
+	if !p.timed {
+		p.bar.Increment()
+		return
+	}
+	if !p.started {
+		p.started = true
+		go p.tick()
+	}
+}
+
+// tick updates the elapsed seconds of a timed progress bar.
+func (p *ProgressReporter) tick() {
+	start := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.bar.Set(int(time.Since(start).Seconds()))
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Finish stops the progress bar.
+func (p *ProgressReporter) Finish(res *Result) error {
+	if p.timed {
+		close(p.done)
+		p.bar.Set64(p.bar.Total)
+	}
+	p.bar.Finish()
+	return nil
+}
+
+// Column is a named value of the summary.
+type Column struct {
+	Name  string
+	Value func(res *Result) string
+}
+
+// DefaultColumns are the columns printed by every benchmark.
+var DefaultColumns = []Column{
+	{"#NUMBER", func(res *Result) string { return fmt.Sprintf("%d", res.Requests) }},
+	{"CONCURRENCY", func(res *Result) string { return fmt.Sprintf("%d", res.Concurrency) }},
+	{"TIME", func(res *Result) string { return fmt.Sprintf("%f", res.Duration.Seconds()) }},
+	{"FAILED", func(res *Result) string { return fmt.Sprintf("%d", res.Failed) }},
+	{"FREQ", func(res *Result) string { return fmt.Sprintf("%f", res.Frequency()) }},
+	{"PERIOD", func(res *Result) string { return fmt.Sprintf("%f", res.Period()) }},
+	{"MIN", func(res *Result) string { return seconds(res.Latency.Min()) }},
+	{"MEAN", func(res *Result) string { return seconds(res.Latency.Mean()) }},
+	{"STDDEV", func(res *Result) string { return seconds(res.Latency.StdDev()) }},
+	{"P50", func(res *Result) string { return seconds(res.Latency.Percentile(50)) }},
+	{"P90", func(res *Result) string { return seconds(res.Latency.Percentile(90)) }},
+	{"P99", func(res *Result) string { return seconds(res.Latency.Percentile(99)) }},
+	{"P99.9", func(res *Result) string { return seconds(res.Latency.Percentile(99.9)) }},
+	{"MAX", func(res *Result) string { return seconds(res.Latency.Max()) }},
+	{"PHASE", func(res *Result) string { return res.Phase }},
+	{"ERRORS", func(res *Result) string {
+		if len(res.Errors) == 0 {
+			return "-"
+		}
+		errs := []string{}
+		for _, name := range res.ErrorNames() {
+			errs = append(errs, fmt.Sprintf("%s=%d", name, res.Errors[name].Count))
+		}
+		return strings.Join(errs, ";")
+	}},
+}
+
+// VolumeColumns report the bytes transferred by the successful probes,
+// the volume in MiB and the throughput in MiB/s. The number of objects
+// transferred per second is the FREQ column.
+var VolumeColumns = []Column{
+	{"BYTES", func(res *Result) string { return fmt.Sprintf("%d", res.Bytes) }},
+	{"VOLUME", func(res *Result) string { return fmt.Sprintf("%f", float64(res.Bytes)/1024/1024) }},
+	{"THROUGHPUT", func(res *Result) string { return fmt.Sprintf("%f", res.Throughput()/1024/1024) }},
+}
+
+// TTFBColumns report the time to first byte.
+var TTFBColumns = []Column{
+	{"TTFB-MEAN", func(res *Result) string { return seconds(res.TTFB.Mean()) }},
+	{"TTFB-P50", func(res *Result) string { return seconds(res.TTFB.Percentile(50)) }},
+	{"TTFB-P99", func(res *Result) string { return seconds(res.TTFB.Percentile(99)) }},
+}
+
+// VerifyColumns report the time spent verifying the requests, see
+// Sample.Verify.
+var VerifyColumns = []Column{
+	{"VERIFY-MEAN", func(res *Result) string { return seconds(res.Verify.Mean()) }},
+	{"VERIFY-P50", func(res *Result) string { return seconds(res.Verify.Percentile(50)) }},
+	{"VERIFY-P99", func(res *Result) string { return seconds(res.Verify.Percentile(99)) }},
+}
+
+// TransferColumns are the VolumeColumns followed by the TTFBColumns.
+var TransferColumns = append(append([]Column{}, VolumeColumns...), TTFBColumns...)
+
+// OpColumn reports the operation of the row, "all" for the aggregate of a
+// phase.
+var OpColumn = Column{"OP", func(res *Result) string {
+	if res.Op == "" {
+		return "all"
+	}
+	return res.Op
+}}
+
+// BucketColumn reports the size bucket of the row, "all" for the aggregate
+// of a phase or an operation.
+var BucketColumn = Column{"SIZE", func(res *Result) string {
+	if res.Bucket == "" {
+		return "all"
+	}
+	return res.Bucket
+}}
+
+// MissedColumn reports the probes of a run with a rate that were scheduled
+// but never started, see Result.Missed.
+var MissedColumn = Column{"MISSED", func(res *Result) string {
+	return fmt.Sprintf("%d", res.Missed)
+}}
+
+// seconds formats d as seconds like the TIME column.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%f", d.Seconds())
+}
+
+// Output formats of the summary.
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// SummaryReporter writes a summary of the run to W, one row per phase
+// followed by one row per operation and size bucket of the phase, if any.
+// The summary is written as an aligned table unless Format is FormatCSV.
+// Tables are followed by the breakdown of the errors with a sample message
+// of each class. If Columns is nil DefaultColumns is used.
+type SummaryReporter struct {
+	W       io.Writer
+	Columns []Column
+	Format  string
+}
+
+// Start does nothing.
+func (s *SummaryReporter) Start(r *Runner) {}
+
+// Report does nothing.
+func (s *SummaryReporter) Report(sample Sample) {}
+
+// Finish writes the summary.
+func (s *SummaryReporter) Finish(res *Result) error {
+	columns := s.Columns
+	if columns == nil {
+		columns = DefaultColumns
+	}
+
+	header := []string{}
+	for _, c := range columns {
+		name := c.Name
+		if s.Format == FormatCSV {
+			name = strings.TrimPrefix(name, "#")
+		}
+		header = append(header, name)
+	}
+	data := [][]string{header}
+	for _, row := range rows(res) {
+		values := []string{}
+		for _, c := range columns {
+			values = append(values, c.Value(row))
+		}
+		data = append(data, values)
+	}
+
+	if s.Format == FormatCSV {
+		w := csv.NewWriter(s.W)
+		if err := w.WriteAll(data); err != nil {
+			return err
+		}
+		return w.Error()
+	}
+
+	if err := writeTable(s.W, data); err != nil {
+		return err
+	}
+
+	errs := [][]string{{"#ERROR", "COUNT", "PHASE", "SAMPLE"}}
+	for _, phase := range res.Phases() {
+		for _, name := range phase.ErrorNames() {
+			e := phase.Errors[name]
+			errs = append(errs, []string{name, fmt.Sprintf("%d", e.Count), phase.Phase, e.Sample})
+		}
+	}
+	if len(errs) == 1 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(s.W); err != nil {
+		return err
+	}
+	return writeTable(s.W, errs)
+}
+
+// writeTable writes data as aligned columns.
+func writeTable(out io.Writer, data [][]string) error {
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	for _, d := range data {
+		if _, err := fmt.Fprintln(w, strings.Join(d, "\t")); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// rows returns the results of every phase followed by the results of its
+// operations and size buckets.
+func rows(res *Result) []*Result {
+	rows := []*Result{}
+	for _, phase := range res.Phases() {
+		rows = append(rows, phase)
+		for _, name := range phase.OpNames() {
+			rows = append(rows, phase.Ops[name])
+		}
+		for _, name := range phase.BucketNames() {
+			rows = append(rows, phase.Buckets[name])
+		}
+	}
+	return rows
+}
@@ -0,0 +1,171 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"sort"
+	"time"
+)
+
+// Result holds the outcome of a phase of a benchmark run.
+type Result struct {
+	Phase       string
+	Op          string
+	Bucket      string
+	Requests    int
+	Concurrency int
+	Failed      int
+	Start       time.Time
+	Duration    time.Duration
+	// Latency holds the wall time of every successful probe.
+	Latency *Histogram
+	// TTFB holds the time to first byte of the successful probes that
+	// reported it.
+	TTFB *Histogram
+	// Verify holds the verification time of the successful probes that
+	// reported it.
+	Verify *Histogram
+	// Bytes is the payload transferred by the successful probes.
+	Bytes int64
+	// Warmup and RampUp hold the results of the phases executed before
+	// the measured one, if any.
+	Warmup *Result
+	RampUp *Result
+	// Ops holds the results broken down by operation, if the probe
+	// reported them.
+	Ops map[string]*Result
+	// Buckets holds the results broken down by size bucket, if the probe
+	// reported them.
+	Buckets map[string]*Result
+	// Errors holds the failed probes broken down by ClassifyError.
+	Errors map[string]*ErrorClass
+	// Missed is the number of probes scheduled by a Runner with a Rate
+	// that were never started because the phase ended while all the
+	// workers were busy. They are not part of Requests.
+	Missed int
+	// Interrupted is set when the run was cancelled before completion.
+	Interrupted bool
+}
+
+func newResult(phase, op, bucket string, concurrency int) *Result {
+	return &Result{
+		Phase:       phase,
+		Op:          op,
+		Bucket:      bucket,
+		Concurrency: concurrency,
+		Latency:     NewHistogram(),
+		TTFB:        NewHistogram(),
+		Verify:      NewHistogram(),
+		Errors:      map[string]*ErrorClass{},
+	}
+}
+
+// add accounts the sample s.
+func (r *Result) add(s Sample) {
+	r.Requests++
+	if s.Err != nil {
+		r.Failed++
+		class := ClassifyError(s.Err)
+		e, ok := r.Errors[class]
+		if !ok {
+			e = &ErrorClass{Sample: s.Err.Error()}
+			r.Errors[class] = e
+		}
+		e.Count++
+		return
+	}
+	r.Latency.Record(s.Latency)
+	r.Bytes += s.Bytes
+	if s.TTFB > 0 {
+		r.TTFB.Record(s.TTFB)
+	}
+	if s.Verify > 0 {
+		r.Verify.Record(s.Verify)
+	}
+}
+
+// OpNames returns the names of the operations in Ops sorted alphabetically.
+func (r *Result) OpNames() []string {
+	names := []string{}
+	for name := range r.Ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BucketNames returns the names of the size buckets in Buckets from the
+// smallest to the largest.
+func (r *Result) BucketNames() []string {
+	names := []string{}
+	for _, name := range sizeBucketNames {
+		if _, ok := r.Buckets[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Phases returns the results of all the executed phases in order.
+func (r *Result) Phases() []*Result {
+	phases := []*Result{}
+	for _, p := range []*Result{r.Warmup, r.RampUp} {
+		if p != nil {
+			phases = append(phases, p)
+		}
+	}
+	return append(phases, r)
+}
+
+// ErrorNames returns the classes in Errors sorted alphabetically.
+func (r *Result) ErrorNames() []string {
+	names := []string{}
+	for name := range r.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// End returns the time at which the phase finished.
+func (r *Result) End() time.Time {
+	return r.Start.Add(r.Duration)
+}
+
+// Succeeded returns the number of probes that completed without error.
+func (r *Result) Succeeded() int {
+	return r.Requests - r.Failed
+}
+
+// Frequency returns the number of successful probes per second.
+func (r *Result) Frequency() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Succeeded()) / r.Duration.Seconds()
+}
+
+// Period returns the inverse of the frequency in seconds.
+func (r *Result) Period() float64 {
+	return 1 / r.Frequency()
+}
+
+// Throughput returns the transferred bytes per second.
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
@@ -0,0 +1,365 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench implements the scheduling loop shared by all the
+// benchmark commands. A command only has to provide a Probe that performs
+// a single request; the Runner takes care of concurrency, progress
+// reporting and the summary.
+package bench
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe performs a single request against the server. Probes that transfer
+// data can fill in the Bytes, TTFB and Bucket fields of s, the rest of the
+// sample is filled in by the Runner. Probes that mix different operations
+// also fill in the Op field, and probes that verify the outcome of their
+// request the Verify field.
+type Probe interface {
+	Do(ctx context.Context, s *Sample) error
+}
+
+// ProbeFunc is an adapter to allow the use of ordinary functions as probes.
+type ProbeFunc func(ctx context.Context, s *Sample) error
+
+// Do calls f(ctx, s).
+func (f ProbeFunc) Do(ctx context.Context, s *Sample) error {
+	return f(ctx, s)
+}
+
+// Names of the phases of a run.
+const (
+	PhaseWarmup  = "warmup"
+	PhaseRampUp  = "ramp-up"
+	PhaseMeasure = "measure"
+)
+
+// Sample is the outcome of a single probe.
+type Sample struct {
+	Phase string
+	// Op is the name of the operation performed by probes that mix
+	// different kinds of requests. Results are broken down by it.
+	Op string
+	// Bucket is the size bucket of the payload transferred by probes that
+	// transfer objects of different sizes, see SizeBucket. Results are
+	// broken down by it.
+	Bucket  string
+	Err     error
+	Latency time.Duration
+	// Bytes is the size of the payload transferred by the probe.
+	Bytes int64
+	// TTFB is the time until the server started to respond.
+	TTFB time.Duration
+	// Verify is the time the probe spent verifying the outcome of the
+	// request after it completed. It is not part of Latency.
+	Verify time.Duration
+}
+
+// Runner executes a Probe using Concurrency workers. When Duration is
+// set the workers keep issuing probes until it elapses, otherwise exactly
+// Requests probes are executed.
+//
+// By default the runner works in closed loop: a worker issues the next probe
+// as soon as the previous one finishes. When Rate is set the probes are
+// scheduled on a fixed timetable instead (or with exponential inter-arrival
+// times if Poisson is set) and their latency is measured from the intended
+// start time, so time spent waiting for a free worker is accounted as
+// latency. Concurrency then bounds the number of outstanding probes, and the
+// probes that could not be started before the end of a timed phase are
+// counted as missed.
+//
+// Before the measured phase the runner can execute a warm-up phase of
+// WarmupRequests probes or WarmupDuration time, and a ramp-up phase in
+// which the number of workers grows linearly from 1 to Concurrency over
+// RampUp. Neither of them is part of the measured result.
+//
+// Every probe is given Timeout to complete, if set. Rand draws the Poisson
+// inter-arrival times; a generator seeded with the current time is used if
+// it is nil.
+type Runner struct {
+	Probe          Probe
+	Concurrency    int
+	Requests       int
+	Duration       time.Duration
+	Rate           float64
+	Poisson        bool
+	Rand           *rand.Rand
+	WarmupRequests int
+	WarmupDuration time.Duration
+	RampUp         time.Duration
+	Timeout        time.Duration
+	Reporters      []Reporter
+}
+
+// phase describes when a phase of the run is over.
+type phase struct {
+	name     string
+	requests int
+	duration time.Duration
+	// rampUp is the period over which the workers are started.
+	rampUp time.Duration
+}
+
+// Run executes the benchmark and returns the result of the measured phase.
+// The returned error is the first error returned by a reporter, probe
+// errors are only counted.
+func (r *Runner) Run() (*Result, error) {
+	return r.RunContext(context.Background())
+}
+
+// RunContext is like Run but stops issuing probes and cancels the
+// outstanding ones when ctx is done. The probes cancelled that way are not
+// accounted and the result is marked as interrupted.
+func (r *Runner) RunContext(ctx context.Context) (*Result, error) {
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for _, rep := range r.Reporters {
+		rep.Start(r)
+	}
+
+	var warmup, rampUp *Result
+	if r.WarmupRequests > 0 || r.WarmupDuration > 0 {
+		p := phase{name: PhaseWarmup, requests: r.WarmupRequests, duration: r.WarmupDuration}
+		warmup = r.runPhase(ctx, p, concurrency)
+	}
+	if r.RampUp > 0 {
+		p := phase{name: PhaseRampUp, duration: r.RampUp, rampUp: r.RampUp}
+		rampUp = r.runPhase(ctx, p, concurrency)
+	}
+
+	if r.Duration <= 0 && concurrency > r.Requests && r.Requests > 0 {
+		concurrency = r.Requests
+	}
+	p := phase{name: PhaseMeasure, requests: r.Requests, duration: r.Duration}
+	res := r.runPhase(ctx, p, concurrency)
+	res.Warmup = warmup
+	res.RampUp = rampUp
+	res.Interrupted = ctx.Err() != nil
+
+	var firstErr error
+	for _, rep := range r.Reporters {
+		if err := rep.Finish(res); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return res, firstErr
+}
+
+// runPhase executes the probes of a single phase.
+func (r *Runner) runPhase(ctx context.Context, p phase, concurrency int) *Result {
+	res := newResult(p.name, "", "", concurrency)
+
+	jobs := make(chan time.Time)
+	samples := make(chan Sample)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if p.rampUp > 0 {
+				delay := p.rampUp * time.Duration(i) / time.Duration(concurrency)
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			for intended := range jobs {
+				probeStart := intended
+				if probeStart.IsZero() {
+					probeStart = time.Now()
+				}
+				s := Sample{Phase: p.name}
+				s.Err = r.do(ctx, &s)
+				s.Latency = time.Since(probeStart) - s.Verify
+				if s.Err != nil && ctx.Err() != nil {
+					// cancelled with the run
+					continue
+				}
+				samples <- s
+			}
+		}(i)
+	}
+
+	missed := make(chan int, 1)
+	go func() { missed <- r.dispatch(ctx, jobs, p) }()
+
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	for s := range samples {
+		res.add(s)
+		if s.Op != "" {
+			if res.Ops == nil {
+				res.Ops = map[string]*Result{}
+			}
+			op, ok := res.Ops[s.Op]
+			if !ok {
+				op = newResult(p.name, s.Op, "", concurrency)
+				res.Ops[s.Op] = op
+			}
+			op.add(s)
+		}
+		if s.Bucket != "" {
+			if res.Buckets == nil {
+				res.Buckets = map[string]*Result{}
+			}
+			bucket, ok := res.Buckets[s.Bucket]
+			if !ok {
+				bucket = newResult(p.name, "", s.Bucket, concurrency)
+				res.Buckets[s.Bucket] = bucket
+			}
+			bucket.add(s)
+		}
+		for _, rep := range r.Reporters {
+			rep.Report(s)
+		}
+	}
+
+	res.Start = start
+	res.Duration = time.Since(start)
+	res.Missed = <-missed
+	for _, op := range res.Ops {
+		op.Start = res.Start
+		op.Duration = res.Duration
+	}
+	for _, bucket := range res.Buckets {
+		bucket.Start = res.Start
+		bucket.Duration = res.Duration
+	}
+	return res
+}
+
+// do executes the probe applying the timeout.
+func (r *Runner) do(ctx context.Context, s *Sample) error {
+	if r.Timeout <= 0 {
+		return r.Probe.Do(ctx, s)
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	err := r.Probe.Do(probeCtx, s)
+	if err != nil && probeCtx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
+
+// dispatch hands out the jobs of a phase to the workers until the phase is
+// over or ctx is done. Every job carries the intended start time of the
+// probe, which is the zero time in closed loop mode. It returns the number
+// of probes scheduled before the end of a timed phase that were not handed
+// out.
+func (r *Runner) dispatch(ctx context.Context, jobs chan<- time.Time, p phase) int {
+	defer close(jobs)
+
+	var deadline <-chan time.Time
+	end := time.Now().Add(p.duration)
+	if p.duration > 0 {
+		deadline = time.After(p.duration)
+	}
+
+	next := r.schedule()
+	missed := func(intended time.Time) int {
+		n := 0
+		for ; !intended.IsZero() && intended.Before(end); intended = next() {
+			n++
+		}
+		return n
+	}
+
+	for i := 0; p.duration > 0 || i < p.requests; i++ {
+		intended := next()
+		if !intended.IsZero() {
+			select {
+			case <-time.After(intended.Sub(time.Now())):
+			case <-deadline:
+				return missed(intended)
+			case <-ctx.Done():
+				return 0
+			}
+		}
+		select {
+		case jobs <- intended:
+		case <-deadline:
+			return missed(intended)
+		case <-ctx.Done():
+			return 0
+		}
+	}
+	return 0
+}
+
+// schedule returns a function that yields the intended start time of every
+// probe. In closed loop mode it always yields the zero time.
+func (r *Runner) schedule() func() time.Time {
+	if r.Rate <= 0 {
+		return func() time.Time { return time.Time{} }
+	}
+
+	interval := float64(time.Second) / r.Rate
+	rnd := r.Rand
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	next := time.Now()
+	return func() time.Time {
+		t := next
+		gap := interval
+		if r.Poisson {
+			gap = rnd.ExpFloat64() * interval
+		}
+		next = next.Add(time.Duration(gap))
+		return t
+	}
+}
+
+// ParseRate parses a request rate such as "500/s", "30/m" or "500" and
+// returns it in requests per second. The unit may be any duration
+// understood by time.ParseDuration, e.g. "100/10s".
+func ParseRate(s string) (float64, error) {
+	parts := strings.SplitN(s, "/", 2)
+	n, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	if len(parts) == 1 {
+		return n, nil
+	}
+
+	unit := parts[1]
+	if unit != "" && (unit[0] < '0' || unit[0] > '9') {
+		unit = "1" + unit
+	}
+	d, err := time.ParseDuration(unit)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n / d.Seconds(), nil
+}
@@ -0,0 +1,373 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunnerRequests(t *testing.T) {
+	var calls int32
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			if atomic.AddInt32(&calls, 1)%4 == 0 {
+				return errors.New("failed")
+			}
+			s.Bytes = 10
+			return nil
+		}),
+		Concurrency: 3,
+		Requests:    20,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 20 {
+		t.Errorf("probe called %d times, want 20", n)
+	}
+	if res.Requests != 20 || res.Failed != 5 {
+		t.Errorf("Requests, Failed = %d, %d, want 20, 5", res.Requests, res.Failed)
+	}
+	if res.Bytes != 150 {
+		t.Errorf("Bytes = %d, want 150", res.Bytes)
+	}
+	if e := res.Errors[ErrorOther]; e == nil || e.Count != 5 {
+		t.Errorf("Errors = %v, want 5 errors of class %q", res.Errors, ErrorOther)
+	}
+	if res.Phase != PhaseMeasure || res.Interrupted || res.Warmup != nil || res.RampUp != nil {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestRunnerConcurrencyLimitedByRequests(t *testing.T) {
+	r := &Runner{
+		Probe:       ProbeFunc(func(ctx context.Context, s *Sample) error { return nil }),
+		Concurrency: 10,
+		Requests:    4,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Concurrency != 4 {
+		t.Errorf("Concurrency = %d, want 4", res.Concurrency)
+	}
+}
+
+func TestRunnerDuration(t *testing.T) {
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}),
+		Concurrency: 2,
+		Duration:    200 * time.Millisecond,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Duration < 200*time.Millisecond || res.Duration > 400*time.Millisecond {
+		t.Errorf("Duration = %v, want about 200ms", res.Duration)
+	}
+	if res.Requests < 20 || res.Requests > 42 {
+		t.Errorf("Requests = %d, want about 40", res.Requests)
+	}
+}
+
+func TestRunnerRate(t *testing.T) {
+	r := &Runner{
+		Probe:       ProbeFunc(func(ctx context.Context, s *Sample) error { return nil }),
+		Concurrency: 4,
+		Duration:    500 * time.Millisecond,
+		Rate:        100,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the timetable has 50 probes, which can be missed if the machine is
+	// too busy to start them in time but never exceeded
+	if total := res.Requests + res.Missed; res.Requests == 0 || total < 48 || total > 51 {
+		t.Errorf("Requests + Missed = %d + %d, want the 50 scheduled probes", res.Requests, res.Missed)
+	}
+}
+
+func TestRunnerVerifyNotInLatency(t *testing.T) {
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			time.Sleep(10 * time.Millisecond)
+			start := time.Now()
+			time.Sleep(50 * time.Millisecond)
+			s.Verify = time.Since(start)
+			return nil
+		}),
+		Requests: 3,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := res.Latency.Max(); max < 10*time.Millisecond || max >= 50*time.Millisecond {
+		t.Errorf("maximum latency = %v, want about 10ms without the verification", max)
+	}
+	if n, min := res.Verify.Count(), res.Verify.Min(); n != 3 || min < 49*time.Millisecond {
+		t.Errorf("verification count = %d, minimum = %v, want 3 of at least 50ms", n, min)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		Requests: 3,
+		Timeout:  20 * time.Millisecond,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed != 3 {
+		t.Fatalf("Failed = %d, want 3", res.Failed)
+	}
+	if e := res.Errors[ErrorTimeout]; e == nil || e.Count != 3 {
+		t.Errorf("Errors = %v, want 3 errors of class %q", res.Errors, ErrorTimeout)
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			if atomic.AddInt32(&calls, 1) == 5 {
+				cancel()
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		Concurrency: 5,
+		Requests:    100,
+	}
+	done := make(chan *Result, 1)
+	go func() {
+		res, _ := r.RunContext(ctx)
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		if !res.Interrupted {
+			t.Error("Interrupted = false, want true")
+		}
+		if res.Requests != 0 {
+			t.Errorf("Requests = %d, want the cancelled probes not to be accounted", res.Requests)
+		}
+		if n := atomic.LoadInt32(&calls); n >= 100 {
+			t.Errorf("probe called %d times, want the run to stop issuing probes", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after the cancellation")
+	}
+}
+
+func TestRunnerWarmupRequests(t *testing.T) {
+	var calls int32
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		}),
+		Concurrency:    2,
+		Requests:       10,
+		WarmupRequests: 7,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 17 {
+		t.Errorf("probe called %d times, want 17", n)
+	}
+	if res.Warmup == nil || res.Warmup.Phase != PhaseWarmup || res.Warmup.Requests != 7 {
+		t.Fatalf("Warmup = %+v, want 7 requests of phase %s", res.Warmup, PhaseWarmup)
+	}
+	if res.Requests != 10 || res.Latency.Count() != 10 {
+		t.Errorf("Requests = %d, latency count = %d, want the 10 measured requests only", res.Requests, res.Latency.Count())
+	}
+	if res.RampUp != nil {
+		t.Errorf("RampUp = %+v, want nil", res.RampUp)
+	}
+}
+
+func TestRunnerWarmupDuration(t *testing.T) {
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}),
+		Requests:       5,
+		WarmupDuration: 100 * time.Millisecond,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Warmup == nil || res.Warmup.Requests == 0 {
+		t.Fatalf("Warmup = %+v, want the requests of a 100ms phase", res.Warmup)
+	}
+	if res.Warmup.Duration < 100*time.Millisecond {
+		t.Errorf("Warmup.Duration = %v, want at least 100ms", res.Warmup.Duration)
+	}
+	if res.Requests != 5 || res.Latency.Count() != 5 {
+		t.Errorf("Requests = %d, latency count = %d, want the 5 measured requests only", res.Requests, res.Latency.Count())
+	}
+}
+
+func TestRunnerRampUp(t *testing.T) {
+	var mu sync.Mutex
+	var inflight, maxEarly, maxLate int
+	start := time.Now()
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			mu.Lock()
+			inflight++
+			if s.Phase == PhaseRampUp {
+				// the workers are started at 0, 100, 200 and 300ms
+				if time.Since(start) < 80*time.Millisecond && inflight > maxEarly {
+					maxEarly = inflight
+				}
+				if time.Since(start) > 320*time.Millisecond && inflight > maxLate {
+					maxLate = inflight
+				}
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+			return nil
+		}),
+		Concurrency: 4,
+		Requests:    8,
+		RampUp:      400 * time.Millisecond,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RampUp == nil || res.RampUp.Phase != PhaseRampUp || res.RampUp.Requests == 0 {
+		t.Fatalf("RampUp = %+v, want the requests of a 400ms phase", res.RampUp)
+	}
+	if res.Requests != 8 || res.Latency.Count() != 8 {
+		t.Errorf("Requests = %d, latency count = %d, want the 8 measured requests only", res.Requests, res.Latency.Count())
+	}
+	if maxEarly != 1 {
+		t.Errorf("%d probes in flight at the start of the ramp-up, want 1", maxEarly)
+	}
+	if maxLate < 2 {
+		t.Errorf("%d probes in flight at the end of the ramp-up, want up to 4", maxLate)
+	}
+}
+
+func TestRunnerCountsMissedProbes(t *testing.T) {
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}),
+		Concurrency: 1,
+		Duration:    500 * time.Millisecond,
+		Rate:        100,
+	}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Missed < 35 {
+		t.Errorf("Missed = %d, want about 45 of the 50 scheduled probes", res.Missed)
+	}
+	if total := res.Requests + res.Missed; total < 45 || total > 52 {
+		t.Errorf("Requests + Missed = %d + %d, want about 50 scheduled probes", res.Requests, res.Missed)
+	}
+}
+
+func TestRunnerCancelDuringRampUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runner{
+		Probe: ProbeFunc(func(ctx context.Context, s *Sample) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		}),
+		Concurrency: 4,
+		Requests:    10,
+		RampUp:      20 * time.Second,
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	res, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunContext returned %v after the start, want shortly after the cancellation at 100ms", elapsed)
+	}
+	if !res.Interrupted {
+		t.Error("Interrupted = false, want true")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"500", 500},
+		{"500/s", 500},
+		{"30/m", 0.5},
+		{"100/10s", 10},
+		{"1/500ms", 2},
+		{"1.5/s", 1.5},
+		{"3600/h", 1},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if err != nil {
+			t.Errorf("ParseRate(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ParseRate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRateInvalid(t *testing.T) {
+	for _, in := range []string{"", "0", "-1/s", "abc", "10/", "10/x", "10/0s", "10/-1s", "/s"} {
+		if got, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) = %v, want an error", in, got)
+		}
+	}
+}
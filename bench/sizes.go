@@ -0,0 +1,294 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxSize is the largest object size, 1TB. Larger sizes are rejected by
+// ParseSize and the continuous distributions never draw them.
+const MaxSize = 1 << 40
+
+// SizeDistribution is a distribution of object sizes.
+type SizeDistribution interface {
+	// Sample returns a size drawn using rnd.
+	Sample(rnd *rand.Rand) int64
+}
+
+// WeightedSizes is a discrete distribution of sizes, each of them drawn with
+// a probability proportional to its weight.
+type WeightedSizes struct {
+	Sizes   []int64
+	Weights []float64
+}
+
+// Index returns the index of a size drawn using rnd.
+func (w *WeightedSizes) Index(rnd *rand.Rand) int {
+	total := 0.0
+	for _, weight := range w.Weights {
+		total += weight
+	}
+	x := rnd.Float64() * total
+	for i, weight := range w.Weights {
+		if x < weight {
+			return i
+		}
+		x -= weight
+	}
+	return len(w.Sizes) - 1
+}
+
+// Sample returns a size drawn using rnd.
+func (w *WeightedSizes) Sample(rnd *rand.Rand) int64 {
+	return w.Sizes[w.Index(rnd)]
+}
+
+// FixedSize returns the distribution of a single size.
+func FixedSize(size int64) *WeightedSizes {
+	return &WeightedSizes{Sizes: []int64{size}, Weights: []float64{1}}
+}
+
+// CERNDistribution returns the distribution of file sizes found on CERNBox.
+func CERNDistribution() *WeightedSizes {
+	const (
+		kb = 1024
+		mb = 1024 * kb
+	)
+	return &WeightedSizes{
+		Sizes:   []int64{50 * mb, 15 * mb, 10 * mb, 8 * mb, 5 * mb, 4 * mb, 3 * mb, 2 * mb, mb, 500 * kb, 50 * kb, 5 * kb, kb, 100},
+		Weights: []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 11, 32, 28, 15, 5},
+	}
+}
+
+// UniformSizes draws sizes uniformly in [Min, Max].
+type UniformSizes struct {
+	Min, Max int64
+}
+
+// Sample returns a size drawn using rnd.
+func (u *UniformSizes) Sample(rnd *rand.Rand) int64 {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+	return u.Min + rnd.Int63n(u.Max-u.Min+1)
+}
+
+// LognormalSizes draws sizes from a log-normal distribution with the given
+// median and shape parameter Sigma. Sizes above MaxSize are clamped to it.
+type LognormalSizes struct {
+	Median int64
+	Sigma  float64
+}
+
+// Sample returns a size drawn using rnd.
+func (l *LognormalSizes) Sample(rnd *rand.Rand) int64 {
+	size := float64(l.Median) * math.Exp(l.Sigma*rnd.NormFloat64())
+	if size > MaxSize {
+		return MaxSize
+	}
+	return int64(size)
+}
+
+// ParseSizeDistribution parses a size distribution: "cern",
+// "uniform:MIN,MAX", "lognormal:MEDIAN,SIGMA" or the name of a file of
+// size,weight lines. Sizes are parsed with ParseSize. "uniform" defaults to
+// 1KB,10MB and "lognormal" to 1MB,1.
+func ParseSizeDistribution(spec string) (SizeDistribution, error) {
+	name := spec
+	args := []string{}
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name = spec[:i]
+		args = strings.Split(spec[i+1:], ",")
+	}
+
+	invalid := fmt.Errorf("invalid size distribution %q", spec)
+	switch name {
+	case "cern":
+		if len(args) != 0 {
+			return nil, invalid
+		}
+		return CERNDistribution(), nil
+
+	case "uniform":
+		u := &UniformSizes{Min: 1024, Max: 10 * 1024 * 1024}
+		if len(args) != 0 {
+			if len(args) != 2 {
+				return nil, invalid
+			}
+			min, err := ParseSize(args[0])
+			if err != nil {
+				return nil, err
+			}
+			max, err := ParseSize(args[1])
+			if err != nil {
+				return nil, err
+			}
+			if max < min {
+				return nil, invalid
+			}
+			u.Min, u.Max = min, max
+		}
+		return u, nil
+
+	case "lognormal":
+		l := &LognormalSizes{Median: 1024 * 1024, Sigma: 1}
+		if len(args) != 0 {
+			if len(args) != 2 {
+				return nil, invalid
+			}
+			median, err := ParseSize(args[0])
+			if err != nil {
+				return nil, err
+			}
+			sigma, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || sigma < 0 {
+				return nil, invalid
+			}
+			l.Median, l.Sigma = median, sigma
+		}
+		return l, nil
+	}
+
+	w, err := ReadSizeDistribution(spec)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("invalid size distribution %q: it must be cern, uniform, lognormal or a file", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ReadSizeDistribution reads a discrete distribution from a file of
+// size,weight lines. Empty lines and lines starting with # are ignored.
+func ReadSizeDistribution(fn string) (*WeightedSizes, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	w := &WeightedSizes{}
+	scanner := bufio.NewScanner(fd)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected size,weight", fn, line)
+		}
+		size, err := ParseSize(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", fn, line, err)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", fn, line, fields[1])
+		}
+		w.Sizes = append(w.Sizes, size)
+		w.Weights = append(w.Weights, weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	total := 0.0
+	for _, weight := range w.Weights {
+		total += weight
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%s: the distribution has no sizes", fn)
+	}
+	return w, nil
+}
+
+// ParseSize parses a number of bytes with an optional unit: B, KB, MB, GB or
+// TB. Units are powers of 1024, may be lowercase and may omit the B. Sizes
+// above MaxSize are rejected.
+func ParseSize(s string) (int64, error) {
+	units := []string{"T", "G", "M", "K"}
+	multipliers := []int64{1 << 40, 1 << 30, 1 << 20, 1 << 10}
+
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	multiplier := int64(1)
+	for i, unit := range units {
+		if strings.HasSuffix(num, unit) {
+			num = strings.TrimSuffix(num, unit)
+			multiplier = multipliers[i]
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n*float64(multiplier) > MaxSize {
+		return 0, fmt.Errorf("invalid size %q: objects cannot be larger than 1TB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// sizeBuckets are the upper bounds of the size buckets but the last one,
+// which is unbounded, and sizeBucketNames their names.
+var (
+	sizeBuckets     = []int64{4 << 10, 64 << 10, 1 << 20, 16 << 20, 256 << 20}
+	sizeBucketNames = []string{"0-4KiB", "4KiB-64KiB", "64KiB-1MiB", "1MiB-16MiB", "16MiB-256MiB", "256MiB+"}
+)
+
+// SizeBucket returns the name of the size bucket of size, used to break
+// down results by the size of the transferred objects.
+func SizeBucket(size int64) string {
+	for i, bound := range sizeBuckets {
+		if size < bound {
+			return sizeBucketNames[i]
+		}
+	}
+	return sizeBucketNames[len(sizeBucketNames)-1]
+}
+
+// lockedSource is a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+// NewRand returns a generator seeded with seed that is safe for concurrent
+// use.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
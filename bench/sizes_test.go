@@ -0,0 +1,118 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"100", 100},
+		{"100B", 100},
+		{"4KB", 4 << 10},
+		{"4k", 4 << 10},
+		{"1.5MB", 3 << 19},
+		{"2gb", 2 << 30},
+		{"1TB", 1 << 40},
+		{" 10 MB", 10 << 20},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	for _, in := range []string{"", "B", "abc", "-1", "10PB", "1.1TB", "1e30"} {
+		if got, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParseSizeDistribution(t *testing.T) {
+	fd, err := ioutil.TempFile("", "sizes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.WriteString("# size,weight\n4KB,60\n\n1MB, 40\n")
+	fd.Close()
+
+	tests := []struct {
+		in   string
+		want SizeDistribution
+	}{
+		{"cern", CERNDistribution()},
+		{"uniform", &UniformSizes{Min: 1 << 10, Max: 10 << 20}},
+		{"uniform:1KB,2KB", &UniformSizes{Min: 1 << 10, Max: 2 << 10}},
+		{"uniform:5,5", &UniformSizes{Min: 5, Max: 5}},
+		{"lognormal", &LognormalSizes{Median: 1 << 20, Sigma: 1}},
+		{"lognormal:64KB,0.5", &LognormalSizes{Median: 64 << 10, Sigma: 0.5}},
+		{fd.Name(), &WeightedSizes{Sizes: []int64{4 << 10, 1 << 20}, Weights: []float64{60, 40}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSizeDistribution(tt.in)
+		if err != nil {
+			t.Errorf("ParseSizeDistribution(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSizeDistribution(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeDistributionInvalid(t *testing.T) {
+	for _, in := range []string{
+		"cern:1",
+		"uniform:1KB",
+		"uniform:2KB,1KB",
+		"uniform:1KB,2PB",
+		"lognormal:1MB",
+		"lognormal:1MB,-1",
+		"lognormal:1MB,x",
+		"lognormal:2TB,1",
+		"/nonexistent/sizes",
+	} {
+		if got, err := ParseSizeDistribution(in); err == nil {
+			t.Errorf("ParseSizeDistribution(%q) = %+v, want an error", in, got)
+		}
+	}
+}
+
+func TestLognormalSizesClamped(t *testing.T) {
+	l := &LognormalSizes{Median: 1 << 30, Sigma: 100}
+	rnd := NewRand(1)
+	for i := 0; i < 1000; i++ {
+		if size := l.Sample(rnd); size < 0 || size > MaxSize {
+			t.Fatalf("Sample() = %d, want a size between 0 and %d", size, int64(MaxSize))
+		}
+	}
+}
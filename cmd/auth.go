@@ -0,0 +1,152 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/auth"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"os"
+	"sync/atomic"
+)
+
+var credentialsFileFlag string
+
+var authCmd = &cobra.Command{
+	Use:   "auth [<username> <password>]",
+	Short: "Benchmark authenticating users",
+	RunE:  auth,
+	Long: `This benchmark test will measure the authentication of users.
+
+The credentials are given either as arguments or with --credentials-file,
+a CSV file with one username,password pair per line. When a file is used
+the requests rotate through all its users.
+
+Failures due to invalid credentials are reported in the UNAUTHENTICATED
+column and failures to reach the auth unit (connection errors and
+codes.Unavailable) in the TRANSPORT column. The breakdown of all the
+failures is in the ERRORS column.`,
+}
+
+// credential is a username and password pair.
+type credential struct {
+	username string
+	password string
+}
+
+// readCredentials reads username,password pairs from a CSV file.
+func readCredentials(fn string) ([]credential, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	r := csv.NewReader(fd)
+	r.FieldsPerRecord = 2
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	creds := []credential{}
+	for _, rec := range records {
+		creds = append(creds, credential{username: rec[0], password: rec[1]})
+	}
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("No credentials found in %s", fn)
+	}
+	return creds, nil
+}
+
+// unauthenticated returns the number of probes rejected because of invalid
+// credentials.
+func unauthenticated(res *bench.Result) int {
+	if e, ok := res.Errors["grpc:"+codes.Unauthenticated.String()]; ok {
+		return e.Count
+	}
+	return 0
+}
+
+// transport returns the number of probes that failed because the auth unit
+// could not be reached.
+func transport(res *bench.Result) int {
+	n := 0
+	for _, class := range []string{bench.ErrorConnection, "grpc:" + codes.Unavailable.String()} {
+		if e, ok := res.Errors[class]; ok {
+			n += e.Count
+		}
+	}
+	return n
+}
+
+func auth(cmd *cobra.Command, args []string) error {
+	var creds []credential
+	if credentialsFileFlag != "" {
+		vals, err := readCredentials(credentialsFileFlag)
+		if err != nil {
+			return err
+		}
+		creds = vals
+	} else {
+		if len(args) != 2 {
+			cmd.Help()
+			return nil
+		}
+		creds = []credential{{username: args[0], password: args[1]}}
+	}
+
+	con, err := dialPool(authAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	c := authClient{con}
+
+	var next uint64
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		i := atomic.AddUint64(&next, 1) - 1
+		cred := creds[i%uint64(len(creds))]
+		in := &pb.AuthRequest{}
+		in.Username = cred.username
+		in.Password = cred.password
+		_, err := c.Authenticate(ctx, in)
+		return err
+	})
+
+	columns := []bench.Column{
+		{Name: "UNAUTHENTICATED", Value: func(res *bench.Result) string {
+			return fmt.Sprintf("%d", unauthenticated(res))
+		}},
+		{Name: "TRANSPORT", Value: func(res *bench.Result) string {
+			return fmt.Sprintf("%d", transport(res))
+		}},
+	}
+
+	_, err = runBenchmark(cmd, probe, columns)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(authCmd)
+
+	authCmd.Flags().StringVar(&credentialsFileFlag, "credentials-file", "", "CSV file with username,password pairs to rotate through")
+}
@@ -0,0 +1,280 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clawio/clawiobench/bench"
+	"github.com/clawio/clawiobench/fakeserver"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+// testPhase is the part of a phase of the JSON results checked by the
+// tests.
+type testPhase struct {
+	Phase    string `json:"phase"`
+	Requests int    `json:"requests"`
+	Failed   int    `json:"failed"`
+	Errors   map[string]struct {
+		Count int `json:"count"`
+	} `json:"errors"`
+}
+
+// startFakeServer serves a fake ClawIO deployment with config on local
+// ports and sets up the flags of the commands to benchmark it as a single
+// user with JSON results. The returned function stops the server.
+func startFakeServer(t *testing.T, config fakeserver.Config) func() {
+	var lis []net.Listener
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis = append(lis, l)
+	}
+	go fakeserver.New(config).Serve(lis[0], lis[1], lis[2])
+	authAddr = lis[0].Addr().String()
+	metaAddr = lis[1].Addr().String()
+	dataAddr = "http://" + lis[2].Addr().String()
+
+	users, err := ioutil.TempFile("", "clawiobench-users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.WriteString("alice,secret\n")
+	users.Close()
+	usersFlag = users.Name()
+
+	probesFlag = 10
+	concurrencyFlag = 2
+	durationFlag = 0
+	rateFlag = ""
+	warmupFlag = ""
+	rampUpFlag = 0
+	timeoutFlag = 0
+	progressBar = false
+	outputFormatFlag = bench.FormatJSON
+	cleanupFlag = true
+	createHomesFlag = false
+	reloginFlag = false
+	credentialsFileFlag = ""
+	prepareFlag = false
+	countFlag = 1
+	bsFlag = 1024
+	sizeDistributionFlag = ""
+	cernDistributionFlag = false
+	payloadFlag = bench.PayloadConstant
+	compressibleRatioFlag = 0.5
+	checksumAlgoFlag = bench.ChecksumNone
+	verifyUploadFlag = ""
+	verifyDownloadFlag = false
+	tlsConfig = nil
+	seed = 1
+	rnd = bench.NewRand(seed)
+	initTransport()
+
+	return func() {
+		for _, l := range lis {
+			l.Close()
+		}
+		os.Remove(users.Name())
+	}
+}
+
+// runCommand runs cmd with args and returns the measured phase of its
+// results.
+func runCommand(t *testing.T, cmd *cobra.Command, args ...string) (*testPhase, error) {
+	buf := &bytes.Buffer{}
+	output = buf
+	if err := cmd.RunE(cmd, args); err != nil {
+		return nil, err
+	}
+
+	var results struct {
+		Phases []*testPhase `json:"phases"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("%s returned invalid JSON: %s\n%s", cmd.Name(), err, buf)
+	}
+	for _, p := range results.Phases {
+		if p.Phase == bench.PhaseMeasure {
+			return p, nil
+		}
+	}
+	t.Fatalf("%s returned no measured phase:\n%s", cmd.Name(), buf)
+	return nil, nil
+}
+
+// checkSucceeded fails the test unless all the requests of p succeeded.
+func checkSucceeded(t *testing.T, name string, p *testPhase, err error) {
+	if err != nil {
+		t.Errorf("%s returned error %v", name, err)
+		return
+	}
+	if p.Requests != probesFlag || p.Failed != 0 {
+		t.Errorf("%s: requests, failed = %d, %d, want %d, 0 (errors: %v)", name, p.Requests, p.Failed, probesFlag, p.Errors)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{Users: map[string]string{"alice": "secret"}})()
+
+	p, err := runCommand(t, mkdirCmd, "/dir-")
+	checkSucceeded(t, "mkdir", p, err)
+
+	p, err = runCommand(t, statCmd, "/")
+	checkSucceeded(t, "stat", p, err)
+
+	p, err = runCommand(t, uploadCmd, "/object")
+	checkSucceeded(t, "upload", p, err)
+
+	p, err = runCommand(t, rmCmd, "/rm-")
+	checkSucceeded(t, "rm", p, err)
+
+	p, err = runCommand(t, cpCmd, "/cp-")
+	checkSucceeded(t, "cp", p, err)
+
+	p, err = runCommand(t, mvCmd, "/mv-")
+	checkSucceeded(t, "mv", p, err)
+
+	p, err = runCommand(t, downloadCmd, "/object")
+	checkSucceeded(t, "download", p, err)
+
+	prepareFlag = true
+	verifyDownloadFlag = true
+	p, err = runCommand(t, downloadCmd, "/prepared-")
+	checkSucceeded(t, "download --prepare --verify", p, err)
+	prepareFlag = false
+	verifyDownloadFlag = false
+
+	p, err = runCommand(t, authCmd, "alice", "secret")
+	checkSucceeded(t, "auth", p, err)
+
+	// the object uploaded above is still there
+	p, err = runCommand(t, statCmd, "/object")
+	checkSucceeded(t, "stat", p, err)
+}
+
+func TestRunScenario(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{})()
+
+	fd, err := ioutil.TempFile("", "clawiobench-scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(`
+operations:
+  - op: mkdir
+    weight: 1
+    path: /run-dir-
+  - op: upload
+    weight: 1
+    path: /run-file-
+    count: 4
+    bs: 256
+  - op: stat
+    weight: 1
+    path: /
+`)
+	fd.Close()
+	fn := fd.Name() + ".yaml"
+	if err := os.Rename(fd.Name(), fn); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fn)
+
+	p, err := runCommand(t, runCmd, fn)
+	checkSucceeded(t, "run", p, err)
+}
+
+// checkIntegrityErrors fails the test unless all the requests of p failed
+// with integrity errors.
+func checkIntegrityErrors(t *testing.T, name string, p *testPhase, err error) {
+	if err != nil {
+		t.Errorf("%s returned error %v", name, err)
+		return
+	}
+	if p.Requests == 0 || p.Failed != p.Requests || p.Errors[bench.ErrorIntegrity].Count != p.Failed {
+		t.Errorf("%s: failed = %d of %d requests, errors = %v, want all failures of class %s", name, p.Failed, p.Requests, p.Errors, bench.ErrorIntegrity)
+	}
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{TruncateRate: 1})()
+
+	verifyUploadFlag = verifyStat
+	p, err := runCommand(t, uploadCmd, "/object")
+	checkIntegrityErrors(t, "upload --verify=stat", p, err)
+	verifyUploadFlag = ""
+
+	prepareFlag = true
+	verifyDownloadFlag = true
+	p, err = runCommand(t, downloadCmd, "/prepared-")
+	checkIntegrityErrors(t, "download --prepare --verify", p, err)
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{CorruptRate: 1})()
+
+	verifyUploadFlag = verifyGet
+	p, err := runCommand(t, uploadCmd, "/object")
+	checkIntegrityErrors(t, "upload --verify=get", p, err)
+	verifyUploadFlag = ""
+
+	prepareFlag = true
+	verifyDownloadFlag = true
+	p, err = runCommand(t, downloadCmd, "/prepared-")
+	checkIntegrityErrors(t, "download --prepare --verify", p, err)
+}
+
+func TestUnavailable(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{UnavailableRate: 0.5})()
+	probesFlag = 50
+
+	// the login of the user before the benchmark fails with the same
+	// rate, so it is tried until it succeeds
+	var p *testPhase
+	var err error
+	for i := 0; i < 20; i++ {
+		if p, err = runCommand(t, statCmd, "/"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class := "grpc:Unavailable"
+	if p.Failed == 0 || p.Failed == p.Requests || p.Errors[class].Count != p.Failed {
+		t.Errorf("failed = %d of %d requests, errors = %v, want some failures, all of class %s", p.Failed, p.Requests, p.Errors, class)
+	}
+}
+
+func TestReset(t *testing.T) {
+	defer startFakeServer(t, fakeserver.Config{ResetRate: 1})()
+
+	p, err := runCommand(t, uploadCmd, "/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Failed != p.Requests || p.Errors[bench.ErrorConnection].Count != p.Failed {
+		t.Errorf("failed = %d of %d requests, errors = %v, want all failures of class %s", p.Failed, p.Requests, p.Errors, bench.ErrorConnection)
+	}
+}
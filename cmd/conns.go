@@ -0,0 +1,210 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	authpb "github.com/clawio/clawiobench/proto/auth"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var connsFlag int
+var idleConnsFlag int
+var tcpKeepaliveFlag time.Duration
+var noKeepaliveFlag bool
+
+// dataClient is the client of the data unit. All the requests share its
+// transport, see initTransport.
+var dataClient = &http.Client{}
+
+// dialer opens the TCP connections to the auth, meta and data units.
+func dialer() *net.Dialer {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: tcpKeepaliveFlag}
+	if tcpKeepaliveFlag <= 0 {
+		d.KeepAlive = -1
+	}
+	return d
+}
+
+// initTransport tunes the transport of the data unit client. By default it
+// keeps as many idle connections as workers so they are reused between
+// requests; with --no-keepalive every request opens a new connection.
+func initTransport() {
+	idle := idleConnsFlag
+	if idle <= 0 {
+		idle = concurrencyFlag
+	}
+	dataClient.Transport = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                dialer().Dial,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   noKeepaliveFlag,
+		MaxIdleConnsPerHost: idle,
+	}
+}
+
+// dial connects to the gRPC unit at addr, using TLS if it is enabled.
+func dial(addr string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		d := dialer()
+		d.Timeout = timeout
+		return d.Dial("tcp", addr)
+	})}
+	if tlsConfig == nil {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	return grpc.Dial(addr, opts...)
+}
+
+// connPool is a set of --conns connections to a gRPC unit among which the
+// requests are spread in rotation. With --no-keepalive it opens a new
+// connection for every request instead.
+type connPool struct {
+	addr  string
+	conns []*grpc.ClientConn
+	next  uint64
+}
+
+// dialPool connects to the gRPC unit at addr.
+func dialPool(addr string) (*connPool, error) {
+	p := &connPool{addr: addr}
+	if noKeepaliveFlag {
+		return p, nil
+	}
+
+	n := connsFlag
+	if n <= 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		con, err := dial(addr)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, con)
+	}
+	return p, nil
+}
+
+// do calls f with the connection of the next request.
+func (p *connPool) do(f func(con *grpc.ClientConn) error) error {
+	if noKeepaliveFlag {
+		con, err := dial(p.addr)
+		if err != nil {
+			return err
+		}
+		defer con.Close()
+		return f(con)
+	}
+
+	i := atomic.AddUint64(&p.next, 1) - 1
+	return f(p.conns[i%uint64(len(p.conns))])
+}
+
+// Close closes the connections of the pool.
+func (p *connPool) Close() error {
+	var firstErr error
+	for _, con := range p.conns {
+		if err := con.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// metaClient is a pb.MetaClient that spreads the requests among the
+// connections of a pool.
+type metaClient struct {
+	pool *connPool
+}
+
+func (c metaClient) Home(ctx context.Context, in *pb.HomeReq, opts ...grpc.CallOption) (out *pb.Void, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Home(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c metaClient) Mkdir(ctx context.Context, in *pb.MkdirReq, opts ...grpc.CallOption) (out *pb.Void, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Mkdir(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c metaClient) Stat(ctx context.Context, in *pb.StatReq, opts ...grpc.CallOption) (out *pb.Metadata, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Stat(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c metaClient) Cp(ctx context.Context, in *pb.CpReq, opts ...grpc.CallOption) (out *pb.Void, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Cp(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c metaClient) Mv(ctx context.Context, in *pb.MvReq, opts ...grpc.CallOption) (out *pb.Void, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Mv(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c metaClient) Rm(ctx context.Context, in *pb.RmReq, opts ...grpc.CallOption) (out *pb.Void, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = pb.NewMetaClient(con).Rm(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+// authClient is an authpb.AuthClient that spreads the requests among the
+// connections of a pool.
+type authClient struct {
+	pool *connPool
+}
+
+func (c authClient) Authenticate(ctx context.Context, in *authpb.AuthRequest, opts ...grpc.CallOption) (out *authpb.AuthResponse, err error) {
+	err = c.pool.do(func(con *grpc.ClientConn) error {
+		out, err = authpb.NewAuthClient(con).Authenticate(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+func init() {
+	RootCmd.PersistentFlags().IntVar(&connsFlag, "conns", 1, "Number of gRPC connections among which the requests to the auth and meta units are spread")
+	RootCmd.PersistentFlags().IntVar(&idleConnsFlag, "idle-conns", 0, "Maximum number of idle connections to the data unit kept for reuse. The default is the concurrency.")
+	RootCmd.PersistentFlags().DurationVar(&tcpKeepaliveFlag, "tcp-keepalive", 30*time.Second, "Period of the TCP keep-alive probes that detect dead connections, 0 to disable them. Connections are still reused, see --no-keepalive.")
+	RootCmd.PersistentFlags().BoolVar(&noKeepaliveFlag, "no-keepalive", false, "Open a new connection for every request instead of reusing them, like HTTP clients without keep-alive. It does not affect the TCP keep-alive probes, see --tcp-keepalive.")
+}
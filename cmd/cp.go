@@ -0,0 +1,103 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"os"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <prefix>",
+	Short: "Benchmark copying resources",
+	RunE:  cp,
+	Long: `This benchmark test will measure the copy of resources.
+
+A source directory is created under <prefix> for every user before the
+benchmark and every request copies it to a new destination whose name is
+<prefix> followed by a random UUID.`,
+}
+
+func cp(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		return err
+	}
+
+	con, err := dialPool(metaAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	c := metaClient{con}
+
+	// every user copies its own source
+	fixtures, err := createFixtures(c, users, args[0]+"clawiobench-cp-src-", len(users.sessions))
+	if err != nil {
+		return err
+	}
+	sources := map[*session]string{}
+	for _, r := range fixtures {
+		sources[r.user] = r.path
+	}
+
+	created := &resourceList{}
+	if cleanupFlag {
+		defer func() {
+			fmt.Fprintln(os.Stderr, "Removing created resources")
+			removeResources(c, append(created.list(), fixtures...))
+		}()
+	}
+
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		dst, err := uniquePath(args[0])
+		if err != nil {
+			return err
+		}
+		user := users.get()
+		err = user.do(ctx, func(token string) error {
+			in := &pb.CpReq{}
+			in.AccessToken = token
+			in.Src = sources[user]
+			in.Dst = dst
+			_, err := c.Cp(ctx, in)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		created.add(user, dst)
+		return nil
+	})
+
+	_, err = runBenchmark(cmd, probe, nil)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(cpCmd)
+
+	cpCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the created resources after the benchmark")
+}
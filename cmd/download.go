@@ -0,0 +1,214 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/md5"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+var prepareFlag bool
+var verifyDownloadFlag bool
+
+var downloadCmd = &cobra.Command{
+	Use:   "download <path>",
+	Short: "Benchmarks the downloading process",
+	RunE:  download,
+	Long: `This benchmark test will measure the download performance.
+
+By default the object at <path> is downloaded on every request. With
+--prepare the test objects are uploaded first, using the same sizes as
+the upload benchmark, and <path> is used as the prefix of their names.
+With --users the objects are uploaded for every user. The prepared objects
+are removed after the benchmark unless --cleanup=false is given.`,
+}
+
+// object is a downloadable object of known content.
+type object struct {
+	target string
+	size   int64
+	md5    string
+}
+
+// prepareObjects uploads the test objects under prefix for every user and
+// adds them to created, one for every payload of a payloadSet. It returns
+// the objects of every user and a function that picks the index of the
+// object to download.
+func prepareObjects(prefix string, users *sessionPool, created *resourceList) (map[*session][]*object, func() int, error) {
+	dist, err := sizeDistribution(sizeDistributionFlag, cernDistributionFlag, countFlag, bsFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+	payloads, err := newPayloadSet(flagPayload(), dist, checksumAlgoFlag, true, rnd.Int63())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objects := map[*session][]*object{}
+	for _, u := range users.sessions {
+		for i, p := range payloads.payloads {
+			target := fmt.Sprintf("%stestfile-%d-%dB", prefix, i, p.Size)
+			ctx, cancel := requestContext()
+			err = u.do(ctx, func(token string) error {
+				return uploadPayload(ctx, p.Payload, target, token, p.checksum)
+			})
+			cancel()
+			if err != nil {
+				return nil, nil, err
+			}
+			created.add(u, target)
+			objects[u] = append(objects[u], &object{target: target, size: p.Size, md5: p.md5})
+		}
+	}
+	return objects, payloads.pick, nil
+}
+
+// downloadObject downloads obj from the data unit discarding its content,
+// or checking it against the expected size and md5 if verify is set. The
+// transferred bytes and the time to first byte are recorded into s. The
+// request is cancelled when ctx is done.
+func downloadObject(ctx context.Context, obj *object, token string, verify bool, s *bench.Sample) error {
+	req, err := http.NewRequest("GET", dataAddr+obj.target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Cancel = ctx.Done()
+
+	start := time.Now()
+	res, err := dataClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	s.TTFB = time.Since(start)
+
+	if res.StatusCode != 200 {
+		return &statusError{code: res.StatusCode}
+	}
+
+	var h hash.Hash
+	var w io.Writer = ioutil.Discard
+	if verify && obj.md5 != "" {
+		h = md5.New()
+		w = h
+	}
+
+	n, err := io.Copy(w, res.Body)
+	if err != nil {
+		return err
+	}
+
+	if verify {
+		size := obj.size
+		if size < 0 {
+			size = res.ContentLength
+		}
+		if size >= 0 && n != size {
+			return newIntegrityError("Downloaded %d bytes from %s but expected %d", n, obj.target, size)
+		}
+		if h != nil {
+			if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != obj.md5 {
+				return newIntegrityError("Downloaded content of %s has md5 %s but expected %s", obj.target, sum, obj.md5)
+			}
+		}
+	}
+
+	s.Bytes = n
+	return nil
+}
+
+func download(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	objects := map[*session][]*object{}
+	for _, u := range users.sessions {
+		objects[u] = []*object{{target: args[0], size: -1}}
+	}
+	pick := func() int { return 0 }
+	if prepareFlag {
+		con, err := dialPool(metaAddr)
+		if err != nil {
+			return err
+		}
+		defer con.Close()
+
+		prepared := &resourceList{}
+		if cleanupFlag {
+			defer func() {
+				fmt.Fprintln(os.Stderr, "Removing test objects")
+				removeResources(metaClient{con}, prepared.list())
+			}()
+		}
+
+		fmt.Fprintln(os.Stderr, "Uploading test objects")
+		objects, pick, err = prepareObjects(args[0], users, prepared)
+		if err != nil {
+			return err
+		}
+	}
+
+	buckets := len(objects[users.sessions[0]]) > 1
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		user := users.get()
+		obj := objects[user][pick()]
+		if buckets {
+			s.Bucket = bench.SizeBucket(obj.size)
+		}
+		return user.do(ctx, func(token string) error {
+			return downloadObject(ctx, obj, token, verifyDownloadFlag, s)
+		})
+	})
+
+	columns := append([]bench.Column{}, bench.TransferColumns...)
+	if buckets {
+		columns = append(columns, bench.BucketColumn)
+	}
+	_, err = runBenchmark(cmd, probe, columns)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(downloadCmd)
+
+	downloadCmd.Flags().BoolVar(&prepareFlag, "prepare", false, "Upload the test objects before the benchmark")
+	downloadCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the prepared test objects after the benchmark")
+	downloadCmd.Flags().IntVar(&countFlag, "count", 1024, "The number of blocks of the prepared files")
+	downloadCmd.Flags().IntVar(&bsFlag, "bs", 1024, "The number of bytes of each block of the prepared files")
+	downloadCmd.Flags().BoolVar(&cernDistributionFlag, "cern-distribution", false, "Prepare files whose sizes follow the distribution found on CERNBox, like --size-distribution cern")
+	downloadCmd.Flags().StringVar(&sizeDistributionFlag, "size-distribution", "", "Distribution of the sizes of the prepared files, see the upload command")
+	downloadCmd.Flags().StringVar(&payloadFlag, "payload", bench.PayloadConstant, "Content of the prepared files: constant, random or compressible")
+	downloadCmd.Flags().Float64Var(&compressibleRatioFlag, "compressible-ratio", 0.5, "Fraction of constant content of compressible prepared files")
+	downloadCmd.Flags().StringVar(&checksumAlgoFlag, "checksum-algo", bench.ChecksumNone, "Compute the checksum sent for every prepared file: md5, sha1, adler32 or none")
+	downloadCmd.Flags().BoolVar(&verifyDownloadFlag, "verify", false, "Verify the size and, for prepared objects, the content of the downloaded data")
+}
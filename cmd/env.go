@@ -17,19 +17,25 @@ package cmd
 import (
 	"fmt"
 	"github.com/spf13/cobra"
-	"os"
 )
 
 var envCmd = &cobra.Command{
 	Use:   "env",
 	Short: "Print env vars used by the cli",
 	Run:   env,
+	Long: `Print env vars used by the cli. The addresses are those of the profile
+in use, if any, so a profile can be exported with:
+
+    eval $(clawiobench env --profile staging)`,
 }
 
 func env(cmd *cobra.Command, args []string) {
-	fmt.Printf("export CLAWIO_BENCH_AUTH_ADDR=%s\n", os.Getenv("CLAWIO_BENCH_AUTH_ADDR"))
-	fmt.Printf("export CLAWIO_BENCH_META_ADDR=%s\n", os.Getenv("CLAWIO_BENCH_META_ADDR"))
-	fmt.Printf("export CLAWIO_BENCH_DATA_ADDR=%s\n", os.Getenv("CLAWIO_BENCH_DATA_ADDR"))
+	if profileName != "" {
+		fmt.Printf("export CLAWIO_BENCH_PROFILE=%s\n", profileName)
+	}
+	fmt.Printf("export CLAWIO_BENCH_AUTH_ADDR=%s\n", authAddr)
+	fmt.Printf("export CLAWIO_BENCH_META_ADDR=%s\n", metaAddr)
+	fmt.Printf("export CLAWIO_BENCH_DATA_ADDR=%s\n", dataAddr)
 }
 
 func init() {
@@ -0,0 +1,71 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+)
+
+// statusError is returned when the data unit answers with an unexpected
+// HTTP status code.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Request failed with status code %d", e.code)
+}
+
+// Class classifies the error by its status code.
+func (e *statusError) Class() string {
+	return fmt.Sprintf("http:%d", e.code)
+}
+
+// integrityError is returned when the data stored or returned by the server
+// does not match the data that was uploaded.
+type integrityError struct {
+	msg string
+}
+
+func newIntegrityError(format string, a ...interface{}) error {
+	return &integrityError{msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *integrityError) Error() string {
+	return e.msg
+}
+
+// Class returns bench.ErrorIntegrity.
+func (e *integrityError) Class() string {
+	return bench.ErrorIntegrity
+}
+
+// verificationError is returned when a request succeeded but its outcome
+// could not be verified, e.g. because the stat of an uploaded object
+// failed.
+type verificationError struct {
+	err error
+}
+
+func (e *verificationError) Error() string {
+	return "Verification failed: " + e.err.Error()
+}
+
+// Class returns the class of the error of the verification prefixed with
+// "verify:".
+func (e *verificationError) Class() string {
+	return "verify:" + bench.ClassifyError(e.err)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/nu7hatch/gouuid"
+	"golang.org/x/net/context"
+	"sync"
+)
+
+var cleanupFlag bool
+
+// uniquePath returns prefix followed by a random UUID drawn from rnd.
+func uniquePath(prefix string) (string, error) {
+	b := make([]byte, 16)
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], rnd.Uint32())
+	}
+	// version 4 and RFC 4122 variant
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	rawUUID, err := uuid.Parse(b)
+	if err != nil {
+		return "", err
+	}
+	return prefix + rawUUID.String(), nil
+}
+
+// resource is a path created by a benchmark and the session of its owner.
+type resource struct {
+	user *session
+	path string
+}
+
+// resourceList is a list of resources safe for concurrent use.
+type resourceList struct {
+	mu        sync.Mutex
+	resources []resource
+}
+
+func (l *resourceList) add(user *session, p string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resources = append(l.resources, resource{user: user, path: p})
+}
+
+// pop removes and returns the last resource of the list.
+func (l *resourceList) pop() (resource, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.resources) == 0 {
+		return resource{}, false
+	}
+	r := l.resources[len(l.resources)-1]
+	l.resources = l.resources[:len(l.resources)-1]
+	return r, true
+}
+
+func (l *resourceList) list() []resource {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]resource{}, l.resources...)
+}
+
+// runQuiet executes probe n times with the configured concurrency and
+// timeout and without reporting anything. It is used to prepare and clean
+// up fixtures.
+func runQuiet(n int, probe bench.Probe) *bench.Result {
+	r := &bench.Runner{Probe: probe, Concurrency: concurrencyFlag, Requests: n, Timeout: timeoutFlag}
+	res, _ := r.Run()
+	return res
+}
+
+// requestContext returns the context of a request made outside of the
+// benchmark, bounded by --timeout if it is set.
+func requestContext() (context.Context, context.CancelFunc) {
+	if timeoutFlag > 0 {
+		return context.WithTimeout(context.Background(), timeoutFlag)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// createFixtures creates n directories whose names start with prefix,
+// distributed among the users, and returns them.
+func createFixtures(c pb.MetaClient, users *sessionPool, prefix string, n int) ([]resource, error) {
+	created := &resourceList{}
+	res := runQuiet(n, bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		p, err := uniquePath(prefix)
+		if err != nil {
+			return err
+		}
+		user := users.get()
+		err = user.do(ctx, func(token string) error {
+			in := &pb.MkdirReq{}
+			in.AccessToken = token
+			in.Path = p
+			_, err := c.Mkdir(ctx, in)
+			return err
+		})
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		created.add(user, p)
+		return nil
+	}))
+
+	if res.Failed > 0 {
+		removeResources(c, created.list())
+		return nil, fmt.Errorf("Cannot create %d of %d fixtures", res.Failed, n)
+	}
+	return created.list(), nil
+}
+
+// removeResources removes resources from the meta unit. Failures are only
+// logged.
+func removeResources(c pb.MetaClient, resources []resource) {
+	pending := &resourceList{resources: resources}
+	runQuiet(len(resources), bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		r, _ := pending.pop()
+		err := r.user.do(ctx, func(token string) error {
+			in := &pb.RmReq{}
+			in.AccessToken = token
+			in.Path = r.path
+			_, err := c.Rm(ctx, in)
+			return err
+		})
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		return nil
+	}))
+}
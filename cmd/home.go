@@ -19,7 +19,6 @@ import (
 	pb "github.com/clawio/clawiobench/proto/metadata"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
-	"google.golang.org/grpc"
 	"os"
 )
 
@@ -37,11 +36,9 @@ func home(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	addr := os.Getenv("CLAWIO_BENCH_META_ADDR")
-
-	con, err := grpc.Dial(addr, grpc.WithInsecure())
+	con, err := dial(metaAddr)
 	if err != nil {
-		fmt.Println("Cannot connect to server " + addr)
+		fmt.Println("Cannot connect to server " + metaAddr)
 		os.Exit(1)
 	}
 
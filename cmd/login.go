@@ -9,25 +9,38 @@ import (
 	"google.golang.org/grpc/codes"
 	"io/ioutil"
 	"os"
-	"os/user"
 	"path"
 )
 
 // loginCmd represents the login command
 var loginCmd = &cobra.Command{
-	Use:   "login <username> <password>",
+	Use:   "login [<username> <password>]",
 	Short: "Login into ClawIO",
 	Run:   login,
+	Long: `Login into ClawIO and save the token for the rest of commands.
+
+Without arguments the credentials are taken from the profile in use or
+from CLAWIO_BENCH_USERNAME and CLAWIO_BENCH_PASSWORD. Every profile keeps
+its own token.`,
 }
 
 func login(cmd *cobra.Command, args []string) {
 
-	if len(args) != 2 {
+	in := &pb.AuthRequest{}
+	switch len(args) {
+	case 0:
+		in.Username = username
+		in.Password = password
+	case 2:
+		in.Username = args[0]
+		in.Password = args[1]
+	}
+	if in.Username == "" || in.Password == "" {
 		cmd.Help()
 		os.Exit(1)
 	}
 
-	con, err := grpc.Dial(authAddr, grpc.WithInsecure())
+	con, err := dial(authAddr)
 	if err != nil {
 		log.Error(err)
 		fmt.Println("Cannot connect to authentication unit")
@@ -38,10 +51,6 @@ func login(cmd *cobra.Command, args []string) {
 
 	c := pb.NewAuthClient(con)
 
-	in := &pb.AuthRequest{}
-	in.Username = args[0]
-	in.Password = args[1]
-
 	ctx := context.Background()
 
 	res, err := c.Authenticate(ctx, in)
@@ -54,29 +63,33 @@ func login(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	// Save token into $HOME/.clawiobench/credentials
-	u, err := user.Current()
+	// Save token into $HOME/.clawiobench/credentials, or credentials-<profile>
+	fn, err := credentialsFile()
 	if err != nil {
 		log.Error(err)
 		fmt.Println("Cannot access your home directory")
 		os.Exit(1)
 	}
 
-	err = os.MkdirAll(path.Join(u.HomeDir, ".clawiobench"), 0755)
+	err = os.MkdirAll(path.Dir(fn), 0755)
 	if err != nil {
 		log.Error(err)
 		fmt.Println("Cannot create $HOME/.clawiobench configuration directory")
 		os.Exit(1)
 	}
 
-	err = ioutil.WriteFile(path.Join(u.HomeDir, ".clawiobench", "credentials"), []byte(res.Token), 0644)
+	err = ioutil.WriteFile(fn, []byte(res.Token), 0644)
 	if err != nil {
 		log.Error(err)
-		fmt.Println("Cannot save credentials into $HOME/.clawiobench/credentials")
+		fmt.Println("Cannot save credentials into " + fn)
 		os.Exit(1)
 	}
 
-	fmt.Println("You are logged in as " + in.Username)
+	if profileName != "" {
+		fmt.Printf("You are logged in as %s in profile %s\n", in.Username, profileName)
+	} else {
+		fmt.Println("You are logged in as " + in.Username)
+	}
 	os.Exit(0)
 }
 
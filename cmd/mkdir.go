@@ -0,0 +1,91 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"os"
+)
+
+var mkdirCmd = &cobra.Command{
+	Use:   "mkdir <prefix>",
+	Short: "Benchmark creating directories",
+	RunE:  mkdir,
+	Long: `This benchmark test will measure the creation of directories.
+
+Every request creates a new directory whose name is <prefix> followed
+by a random UUID.`,
+}
+
+func mkdir(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		return err
+	}
+
+	con, err := dialPool(metaAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	c := metaClient{con}
+
+	created := &resourceList{}
+	if cleanupFlag {
+		defer func() {
+			fmt.Fprintln(os.Stderr, "Removing created directories")
+			removeResources(c, created.list())
+		}()
+	}
+
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		p, err := uniquePath(args[0])
+		if err != nil {
+			return err
+		}
+		user := users.get()
+		err = user.do(ctx, func(token string) error {
+			in := &pb.MkdirReq{}
+			in.AccessToken = token
+			in.Path = p
+			_, err := c.Mkdir(ctx, in)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		created.add(user, p)
+		return nil
+	})
+
+	_, err = runBenchmark(cmd, probe, nil)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(mkdirCmd)
+
+	mkdirCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the created directories after the benchmark")
+}
@@ -0,0 +1,115 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"os"
+)
+
+var mvCmd = &cobra.Command{
+	Use:   "mv <prefix>",
+	Short: "Benchmark moving resources",
+	RunE:  mv,
+	Long: `This benchmark test will measure the move of resources.
+
+One directory per concurrent request is created under <prefix> before
+the benchmark. Every request moves one of them to a new name made of
+<prefix> followed by a random UUID.`,
+}
+
+func mv(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		return err
+	}
+
+	con, err := dialPool(metaAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	c := metaClient{con}
+
+	n := concurrencyFlag
+	if n <= 0 {
+		n = 1
+	}
+	fixtures, err := createFixtures(c, users, args[0], n)
+	if err != nil {
+		return err
+	}
+
+	// every fixture is owned by a single request at a time, which moves it
+	// and puts back its new name.
+	pool := make(chan resource, len(fixtures))
+	for _, r := range fixtures {
+		pool <- r
+	}
+
+	if cleanupFlag {
+		defer func() {
+			fmt.Fprintln(os.Stderr, "Removing moved resources")
+			close(pool)
+			resources := []resource{}
+			for r := range pool {
+				resources = append(resources, r)
+			}
+			removeResources(c, resources)
+		}()
+	}
+
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		src := <-pool
+		dst, err := uniquePath(args[0])
+		if err != nil {
+			pool <- src
+			return err
+		}
+		err = src.user.do(ctx, func(token string) error {
+			in := &pb.MvReq{}
+			in.AccessToken = token
+			in.Src = src.path
+			in.Dst = dst
+			_, err := c.Mv(ctx, in)
+			return err
+		})
+		if err != nil {
+			pool <- src
+			return err
+		}
+		pool <- resource{user: src.user, path: dst}
+		return nil
+	})
+
+	_, err = runBenchmark(cmd, probe, nil)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(mvCmd)
+
+	mvCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the moved resources after the benchmark")
+}
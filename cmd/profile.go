@@ -0,0 +1,123 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os/user"
+	"path"
+)
+
+var profileFlag string
+
+// profileName is the profile in use, selected with --profile or
+// CLAWIO_BENCH_PROFILE. It is empty if no profile is used.
+var profileName string
+
+// username and password are the credentials used by login without
+// arguments and by --relogin.
+var username string
+var password string
+
+// profile describes a ClawIO deployment in the profiles section of the
+// configuration file, e.g. in YAML:
+//
+//	CLAWIO_BENCH_PROFILE: staging
+//	profiles:
+//	  staging:
+//	    auth_addr: staging.example.org:57000
+//	    meta_addr: staging.example.org:57001
+//	    data_addr: https://staging.example.org:57002
+//	    username: bench
+//	    password: secret
+//	    tls: true
+//	    ca_cert: /etc/pki/staging-ca.pem
+//
+// The settings of the profile in use override those of the environment.
+// TLS and InsecureSkipVerify are nil if the profile does not set them.
+type profile struct {
+	AuthAddr string `mapstructure:"auth_addr"`
+	MetaAddr string `mapstructure:"meta_addr"`
+	DataAddr string `mapstructure:"data_addr"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	TLS                *bool  `mapstructure:"tls"`
+	CACert             string `mapstructure:"ca_cert"`
+	ClientCert         string `mapstructure:"client_cert"`
+	ClientKey          string `mapstructure:"client_key"`
+	InsecureSkipVerify *bool  `mapstructure:"insecure_skip_verify"`
+}
+
+// applyProfile overrides the configuration with the settings of the
+// profile in use, if any.
+func applyProfile() error {
+	profileName = profileFlag
+	if profileName == "" {
+		profileName = viper.GetString("CLAWIO_BENCH_PROFILE")
+	}
+	if profileName == "" {
+		return nil
+	}
+
+	key := "profiles." + profileName
+	if viper.Get(key) == nil {
+		return fmt.Errorf("Profile %s not found in the configuration file", profileName)
+	}
+	p := profile{}
+	if err := viper.UnmarshalKey(key, &p); err != nil {
+		return fmt.Errorf("Invalid profile %s: %s", profileName, err)
+	}
+
+	override := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	override(&authAddr, p.AuthAddr)
+	override(&metaAddr, p.MetaAddr)
+	override(&dataAddr, p.DataAddr)
+	override(&username, p.Username)
+	override(&password, p.Password)
+	override(&caCert, p.CACert)
+	override(&clientCert, p.ClientCert)
+	override(&clientKey, p.ClientKey)
+	if p.TLS != nil {
+		tlsEnabled = *p.TLS
+	}
+	if p.InsecureSkipVerify != nil {
+		insecureSkipVerify = *p.InsecureSkipVerify
+	}
+	return nil
+}
+
+// credentialsFile returns the file where login saves the token. Every
+// profile has its own.
+func credentialsFile() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	fn := "credentials"
+	if profileName != "" {
+		fn += "-" + profileName
+	}
+	return path.Join(u.HomeDir, ".clawiobench", fn), nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Profile of the configuration file with the addresses, TLS settings and credentials of the ClawIO deployment to use")
+}
@@ -0,0 +1,54 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestApplyProfileTLS(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("profiles", map[string]interface{}{
+		"plain":   map[string]interface{}{"tls": false, "insecure_skip_verify": false},
+		"secure":  map[string]interface{}{"tls": true},
+		"default": map[string]interface{}{"auth_addr": "auth:57000"},
+	})
+	defer func() { profileFlag = "" }()
+
+	tests := []struct {
+		profile  string
+		env      bool
+		want     bool
+		insecure bool
+	}{
+		{"plain", true, false, false},
+		{"secure", false, true, true},
+		{"default", true, true, true},
+		{"default", false, false, true},
+	}
+	for _, tt := range tests {
+		profileFlag = tt.profile
+		tlsEnabled = tt.env
+		insecureSkipVerify = true
+		if err := applyProfile(); err != nil {
+			t.Errorf("applyProfile(%s) returned error %v", tt.profile, err)
+			continue
+		}
+		if tlsEnabled != tt.want || insecureSkipVerify != tt.insecure {
+			t.Errorf("profile %s with TLS %v in the environment: TLS, insecure = %v, %v, want %v, %v", tt.profile, tt.env, tlsEnabled, insecureSkipVerify, tt.want, tt.insecure)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"os"
+)
+
+var fixturesFlag int
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <prefix>",
+	Short: "Benchmark removing resources",
+	RunE:  rm,
+	Long: `This benchmark test will measure the removal of resources.
+
+The directories to remove are created under <prefix> before the
+benchmark, one per request. When the benchmark is limited by time the
+number of directories to create has to be given with --fixtures.`,
+}
+
+func rm(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	n := fixturesFlag
+	if n <= 0 {
+		warmupRequests, warmupDuration, err := parseWarmup()
+		if err != nil {
+			return err
+		}
+		if durationFlag > 0 || warmupDuration > 0 || rampUpFlag > 0 {
+			return errors.New("--fixtures is required when the benchmark is limited by time")
+		}
+		n = probesFlag + warmupRequests
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		return err
+	}
+
+	con, err := dialPool(metaAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	c := metaClient{con}
+
+	fmt.Fprintf(os.Stderr, "Creating %d directories to remove\n", n)
+	fixtures, err := createFixtures(c, users, args[0], n)
+	if err != nil {
+		return err
+	}
+	pending := &resourceList{resources: fixtures}
+
+	if cleanupFlag {
+		defer func() {
+			fmt.Fprintln(os.Stderr, "Removing remaining directories")
+			removeResources(c, pending.list())
+		}()
+	}
+
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		r, ok := pending.pop()
+		if !ok {
+			return errors.New("No directories left to remove")
+		}
+		err := r.user.do(ctx, func(token string) error {
+			in := &pb.RmReq{}
+			in.AccessToken = token
+			in.Path = r.path
+			_, err := c.Rm(ctx, in)
+			return err
+		})
+		if err != nil {
+			pending.add(r.user, r.path)
+			return err
+		}
+		return nil
+	})
+
+	_, err = runBenchmark(cmd, probe, nil)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(rmCmd)
+
+	rmCmd.Flags().IntVar(&fixturesFlag, "fixtures", 0, "Number of directories to create before the benchmark. The default is one per request.")
+	rmCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the directories left after the benchmark")
+}
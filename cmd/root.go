@@ -19,18 +19,46 @@ import (
 	"os"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/clawio/clawiobench/bench"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/net/context"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"os/signal"
 	"os/user"
 	"path"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 var probesFlag int
 var concurrencyFlag int
+var durationFlag time.Duration
+var rateFlag string
+var poissonFlag bool
+var warmupFlag string
+var rampUpFlag time.Duration
+var timeoutFlag time.Duration
 var csvFile string
+var outputFormatFlag string
 var progressBar bool
+var seedFlag int64
+
+// rnd is the generator shared by everything random in a benchmark: the
+// sizes and content of the objects, the random paths, the operations of
+// scenarios and the Poisson arrivals. It is seeded with seed.
+var rnd *rand.Rand
+var seed int64
+
+// gitVersion is the version of clawiobench included in the reports. It is
+// set at build time with:
+//
+//	go install -ldflags "-X github.com/clawio/clawiobench/cmd.gitVersion=$(git describe --always)"
+var gitVersion = "unknown"
 
 var cfgFile string
 var authAddr string
@@ -39,6 +67,11 @@ var metaAddr string
 var log *logrus.Logger
 var output io.Writer
 
+// interruptedBy is the signal that interrupted the benchmark, if any. The
+// process exits with a non-zero status after the partial results are
+// reported and the created resources removed.
+var interruptedBy os.Signal
+
 // This represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "clawiobench",
@@ -47,11 +80,30 @@ var RootCmd = &cobra.Command{
 It is designed to give you an impression of how your current ClawIO installation performs.
 This especially shows you how many requests per second your ClawIO installation is capable of serving.`,
 
+	PersistentPreRun: checkAddrs,
+
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
 }
 
+// checkAddrs exits if the address of any unit is missing. Commands that do
+// not talk to ClawIO override it with their own PersistentPreRun.
+func checkAddrs(cmd *cobra.Command, args []string) {
+	if authAddr == "" {
+		fmt.Println("You have to specify the auth unit address")
+		os.Exit(1)
+	}
+	if dataAddr == "" {
+		fmt.Println("You have to specify the data unit address")
+		os.Exit(1)
+	}
+	if metaAddr == "" {
+		fmt.Println("You have to specify the meta unit address")
+		os.Exit(1)
+	}
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -59,10 +111,14 @@ func Execute() {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
+	if sig, ok := interruptedBy.(syscall.Signal); ok {
+		// exit like a shell does for a process killed by sig
+		os.Exit(128 + int(sig))
+	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initConfig, initRand)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports Persistent Flags, which, if defined here,
@@ -70,8 +126,16 @@ func init() {
 
 	RootCmd.PersistentFlags().IntVarP(&probesFlag, "requests", "n", 1, "Number of requests to perform for the benchmarking session. The default is to just perform a single request which usually leads to non-representative benchmarking results.")
 	RootCmd.PersistentFlags().IntVarP(&concurrencyFlag, "concurrency", "c", 1, "Number of multiple requests to perform at a time. Default is one request at a time.")
-	RootCmd.PersistentFlags().StringVarP(&csvFile, "csv-file", "e", "", "Write the results to  a Comma separated value (CSV) file.")
+	RootCmd.PersistentFlags().DurationVar(&durationFlag, "duration", 0, "Duration of the benchmarking session, e.g. 10m. When set, requests are issued until it elapses and the number of requests is ignored.")
+	RootCmd.PersistentFlags().StringVar(&rateFlag, "rate", "", "Issue requests at a constant rate, e.g. 500/s, instead of as fast as possible. Latency is measured from the scheduled start of each request.")
+	RootCmd.PersistentFlags().BoolVar(&poissonFlag, "poisson", false, "Use Poisson arrivals with the average given by --rate instead of a fixed interval")
+	RootCmd.PersistentFlags().StringVar(&warmupFlag, "warmup", "", "Number of requests (e.g. 100) or duration (e.g. 30s) of a warm-up phase whose requests are not measured")
+	RootCmd.PersistentFlags().DurationVar(&rampUpFlag, "ramp-up", 0, "Linearly raise the concurrency from 1 to the given concurrency over this period before measuring")
+	RootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 0, "Maximum time to wait for each request, e.g. 30s. The default is to wait forever.")
+	RootCmd.PersistentFlags().StringVarP(&csvFile, "csv-file", "e", "", "Write the results to a file instead of the standard output.")
+	RootCmd.PersistentFlags().StringVar(&outputFormatFlag, "output-format", bench.FormatTable, "Format of the results: table, csv or json")
 	RootCmd.PersistentFlags().BoolVar(&progressBar, "progress-bar", true, "Show progress bar")
+	RootCmd.PersistentFlags().Int64Var(&seedFlag, "seed", 0, "Seed of the random choices of the benchmark. Runs with the same seed and a concurrency of 1 issue the same requests. The default is a seed based on the current time, which is reported with the results.")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -93,24 +157,28 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 
 	authAddr = viper.GetString("CLAWIO_BENCH_AUTH_ADDR")
-	if authAddr == "" {
-		fmt.Println("You have to specify the auth unit address")
-		os.Exit(1)
-	}
 	dataAddr = viper.GetString("CLAWIO_BENCH_DATA_ADDR")
-	if dataAddr == "" {
-		fmt.Println("You have to specify the data unit address")
+	metaAddr = viper.GetString("CLAWIO_BENCH_META_ADDR")
+	username = viper.GetString("CLAWIO_BENCH_USERNAME")
+	password = viper.GetString("CLAWIO_BENCH_PASSWORD")
+	tlsEnabled = viper.GetBool("CLAWIO_BENCH_TLS")
+	caCert = viper.GetString("CLAWIO_BENCH_CA_CERT")
+	clientCert = viper.GetString("CLAWIO_BENCH_CLIENT_CERT")
+	clientKey = viper.GetString("CLAWIO_BENCH_CLIENT_KEY")
+	insecureSkipVerify = viper.GetBool("CLAWIO_BENCH_INSECURE_SKIP_VERIFY")
+	if err := applyProfile(); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	metaAddr = viper.GetString("CLAWIO_BENCH_META_ADDR")
-	if metaAddr == "" {
-		fmt.Println("You have to specify the meta unit address")
+	if err := initTLS(); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	initTransport()
 
 	if csvFile != "" {
 		fd, err := os.Create(csvFile)
@@ -124,6 +192,16 @@ func initConfig() {
 	}
 }
 
+// initRand seeds rnd with --seed, or with the current time if it was not
+// given.
+func initRand() {
+	seed = seedFlag
+	if !RootCmd.PersistentFlags().Lookup("seed").Changed {
+		seed = time.Now().UnixNano()
+	}
+	rnd = bench.NewRand(seed)
+}
+
 // initLogger instantiate a logger instance that writes to $HOME/.clawiobench.log
 func initLogger() {
 	u, _ := user.Current()
@@ -140,15 +218,155 @@ func initLogger() {
 
 func getToken() (string, error) {
 
-	u, err := user.Current()
+	fn, err := credentialsFile()
 	if err != nil {
 		return "", err
 	}
 
-	token, err := ioutil.ReadFile(path.Join(u.HomeDir, ".clawiobench", "credentials"))
+	token, err := ioutil.ReadFile(fn)
 	if err != nil {
 		return "", err
 	}
 
 	return string(token), nil
 }
+
+// logReporter writes the errors of failed probes into the log.
+type logReporter struct{}
+
+func (l *logReporter) Start(r *bench.Runner) {}
+
+func (l *logReporter) Report(s bench.Sample) {
+	if s.Err != nil {
+		log.Error(s.Err)
+	}
+}
+
+func (l *logReporter) Finish(res *bench.Result) error { return nil }
+
+// parseWarmup returns either the number of requests or the duration of the
+// warm-up phase given by --warmup.
+func parseWarmup() (int, time.Duration, error) {
+	if warmupFlag == "" {
+		return 0, 0, nil
+	}
+	if n, err := strconv.Atoi(warmupFlag); err == nil {
+		return n, 0, nil
+	}
+	if d, err := time.ParseDuration(warmupFlag); err == nil {
+		return 0, d, nil
+	}
+	return 0, 0, fmt.Errorf("invalid warmup %q: it must be a number of requests or a duration", warmupFlag)
+}
+
+// runMetadata describes a run in the JSON results.
+type runMetadata struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args"`
+	Flags    map[string]string `json:"flags"`
+	AuthAddr string            `json:"auth_addr"`
+	MetaAddr string            `json:"meta_addr"`
+	DataAddr string            `json:"data_addr"`
+	Seed     int64             `json:"seed"`
+	Version  string            `json:"version"`
+}
+
+func newRunMetadata(cmd *cobra.Command) *runMetadata {
+	m := &runMetadata{
+		Command:  cmd.CommandPath(),
+		Args:     cmd.Flags().Args(),
+		Flags:    map[string]string{},
+		AuthAddr: authAddr,
+		MetaAddr: metaAddr,
+		DataAddr: dataAddr,
+		Seed:     seed,
+		Version:  gitVersion,
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		m.Flags[f.Name] = f.Value.String()
+	})
+	return m
+}
+
+// runBenchmark runs the probe with the settings given by the persistent flags
+// and writes the results of cmd to the output in the chosen format. The
+// columns are reported in addition to the default ones and the seed. The
+// extra reporters are notified before the results are written.
+func runBenchmark(cmd *cobra.Command, probe bench.Probe, columns []bench.Column, extra ...bench.Reporter) (*bench.Result, error) {
+	var rate float64
+	if rateFlag != "" {
+		r, err := bench.ParseRate(rateFlag)
+		if err != nil {
+			return nil, err
+		}
+		rate = r
+	}
+
+	warmupRequests, warmupDuration, err := parseWarmup()
+	if err != nil {
+		return nil, err
+	}
+
+	reporters := []bench.Reporter{&logReporter{}}
+	if progressBar {
+		reporters = append(reporters, &bench.ProgressReporter{})
+	}
+	reporters = append(reporters, extra...)
+	switch outputFormatFlag {
+	case bench.FormatTable, bench.FormatCSV:
+		columns = append(append([]bench.Column{}, bench.DefaultColumns...), columns...)
+		if rate > 0 {
+			columns = append(columns, bench.MissedColumn)
+		}
+		columns = append(columns, bench.Column{Name: "SEED", Value: func(res *bench.Result) string {
+			return strconv.FormatInt(seed, 10)
+		}})
+		reporters = append(reporters, &bench.SummaryReporter{W: output, Columns: columns, Format: outputFormatFlag})
+	case bench.FormatJSON:
+		reporters = append(reporters, &bench.JSONReporter{W: output, Metadata: newRunMetadata(cmd), Extra: columns})
+	default:
+		return nil, fmt.Errorf("invalid output format %q: it must be table, csv or json", outputFormatFlag)
+	}
+
+	runner := &bench.Runner{
+		Probe:          probe,
+		Concurrency:    concurrencyFlag,
+		Requests:       probesFlag,
+		Duration:       durationFlag,
+		Rate:           rate,
+		Poisson:        poissonFlag,
+		Rand:           rnd,
+		WarmupRequests: warmupRequests,
+		WarmupDuration: warmupDuration,
+		RampUp:         rampUpFlag,
+		Timeout:        timeoutFlag,
+		Reporters:      reporters,
+	}
+
+	// SIGINT and SIGTERM cancel the outstanding requests and the results
+	// obtained so far are still reported. A second signal kills the process.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			interruptedBy = sig
+			fmt.Fprintln(os.Stderr, "Interrupted, cancelling outstanding requests")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res, err := runner.RunContext(ctx)
+	if res != nil && res.Interrupted {
+		fmt.Fprintln(os.Stderr, "The benchmark was interrupted, the results are partial")
+	}
+	if res != nil && res.Missed > 0 {
+		fmt.Fprintf(os.Stderr, "%d scheduled requests were never started because all the workers were busy, raise the concurrency to measure them\n", res.Missed)
+	}
+	return res, err
+}
@@ -0,0 +1,426 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <scenario>",
+	Short: "Run a mixed workload described in a scenario file",
+	RunE:  run,
+	Long: `This benchmark runs a mix of operations described in a YAML or TOML
+scenario file, for example:
+
+  concurrency: 10
+  duration: 5m
+  operations:
+    - op: stat
+      weight: 70
+      path: /bench
+    - op: upload
+      weight: 20
+      path: /bench/file-
+      size-distribution: cern
+      payload: random
+      checksum-algo: md5
+    - op: mkdir
+      weight: 10
+      path: /bench/dir-
+
+Every request performs one of the operations chosen at random according
+to their weights. The supported operations are stat, upload, download,
+mkdir, mv and rm. Every operation uses a path generator: "fixed" uses the
+path as is, "uuid" appends a random UUID and "sequence" appends an
+increasing number. stat and download default to "fixed", upload, mkdir
+and mv to "uuid". mv and rm act on the resources created by upload and
+mkdir during the run, the path of mv is the prefix of the destination.
+
+The concurrency, requests, duration, rate, warmup and ramp-up settings
+of the scenario are used unless given on the command line. The summary
+is broken down by operation.`,
+}
+
+// scenario is the content of a scenario file.
+type scenario struct {
+	Concurrency int         `yaml:"concurrency" toml:"concurrency"`
+	Requests    int         `yaml:"requests" toml:"requests"`
+	Duration    string      `yaml:"duration" toml:"duration"`
+	Rate        string      `yaml:"rate" toml:"rate"`
+	Warmup      string      `yaml:"warmup" toml:"warmup"`
+	RampUp      string      `yaml:"ramp-up" toml:"ramp-up"`
+	Operations  []operation `yaml:"operations" toml:"operations"`
+}
+
+// operation is a weighted operation of a scenario.
+type operation struct {
+	Op               string `yaml:"op" toml:"op"`
+	Weight           int    `yaml:"weight" toml:"weight"`
+	Path             string `yaml:"path" toml:"path"`
+	Generator        string `yaml:"generator" toml:"generator"`
+	Children         bool   `yaml:"children" toml:"children"`
+	Count            int    `yaml:"count" toml:"count"`
+	BS               int    `yaml:"bs" toml:"bs"`
+	CERNDistribution bool   `yaml:"cern-distribution" toml:"cern-distribution"`
+	// SizeDistribution, Payload, CompressibleRatio and ChecksumAlgo
+	// describe uploads like the flags of the upload command.
+	// CompressibleRatio is nil if it is not given.
+	SizeDistribution  string   `yaml:"size-distribution" toml:"size-distribution"`
+	Payload           string   `yaml:"payload" toml:"payload"`
+	CompressibleRatio *float64 `yaml:"compressible-ratio" toml:"compressible-ratio"`
+	ChecksumAlgo      string   `yaml:"checksum-algo" toml:"checksum-algo"`
+}
+
+// readScenario reads a scenario from a YAML or TOML file depending on its
+// extension.
+func readScenario(fn string) (*scenario, error) {
+	sc := &scenario{}
+	switch filepath.Ext(fn) {
+	case ".toml":
+		if _, err := toml.DecodeFile(fn, sc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, sc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported scenario file %s: it must be .yaml, .yml or .toml", fn)
+	}
+
+	if len(sc.Operations) == 0 {
+		return nil, errors.New("The scenario has no operations")
+	}
+	for _, op := range sc.Operations {
+		if op.Weight <= 0 {
+			return nil, fmt.Errorf("Operation %s must have a positive weight", op.Op)
+		}
+	}
+	return sc, nil
+}
+
+// apply sets the run settings of the scenario that were not given on the
+// command line.
+func (sc *scenario) apply(cmd *cobra.Command) error {
+	changed := func(name string) bool {
+		f := cmd.Flag(name)
+		return f != nil && f.Changed
+	}
+
+	if sc.Concurrency > 0 && !changed("concurrency") {
+		concurrencyFlag = sc.Concurrency
+		// the idle connections to the data unit are sized by it
+		initTransport()
+	}
+	if sc.Requests > 0 && !changed("requests") {
+		probesFlag = sc.Requests
+	}
+	if sc.Duration != "" && !changed("duration") {
+		d, err := time.ParseDuration(sc.Duration)
+		if err != nil {
+			return err
+		}
+		durationFlag = d
+	}
+	if sc.Rate != "" && !changed("rate") {
+		rateFlag = sc.Rate
+	}
+	if sc.Warmup != "" && !changed("warmup") {
+		warmupFlag = sc.Warmup
+	}
+	if sc.RampUp != "" && !changed("ramp-up") {
+		d, err := time.ParseDuration(sc.RampUp)
+		if err != nil {
+			return err
+		}
+		rampUpFlag = d
+	}
+	return nil
+}
+
+// newPathGenerator returns a function that generates the paths used by an
+// operation.
+func newPathGenerator(prefix, kind string) (func() (string, error), error) {
+	switch kind {
+	case "fixed":
+		return func() (string, error) { return prefix, nil }, nil
+	case "uuid":
+		return func() (string, error) { return uniquePath(prefix) }, nil
+	case "sequence":
+		var n uint64
+		return func() (string, error) {
+			return fmt.Sprintf("%s%d", prefix, atomic.AddUint64(&n, 1)), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown path generator %q", kind)
+}
+
+// scenarioEnv holds what is shared by the operations of a scenario.
+type scenarioEnv struct {
+	users   *sessionPool
+	meta    pb.MetaClient
+	created *resourceList
+}
+
+// newOp returns the probe performing the operation op.
+func (env *scenarioEnv) newOp(op operation) (func(ctx context.Context, s *bench.Sample) error, error) {
+	generator := op.Generator
+	if generator == "" {
+		generator = "fixed"
+		if op.Op == "upload" || op.Op == "mkdir" || op.Op == "mv" {
+			generator = "uuid"
+		}
+	}
+	next, err := newPathGenerator(op.Path, generator)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "stat":
+		return func(ctx context.Context, s *bench.Sample) error {
+			p, err := next()
+			if err != nil {
+				return err
+			}
+			return env.users.get().do(ctx, func(token string) error {
+				in := &pb.StatReq{}
+				in.AccessToken = token
+				in.Path = p
+				in.Children = op.Children
+				_, err := env.meta.Stat(ctx, in)
+				return err
+			})
+		}, nil
+
+	case "upload":
+		count, bs := op.Count, op.BS
+		if count <= 0 {
+			count = 1024
+		}
+		if bs <= 0 {
+			bs = 1024
+		}
+		dist, err := sizeDistribution(op.SizeDistribution, op.CERNDistribution, count, bs)
+		if err != nil {
+			return nil, err
+		}
+
+		payload := bench.Payload{Kind: op.Payload, Ratio: 0.5}
+		if payload.Kind == "" {
+			payload.Kind = bench.PayloadConstant
+		}
+		if op.CompressibleRatio != nil {
+			payload.Ratio = *op.CompressibleRatio
+		}
+		payloads, err := newPayloadSet(payload, dist, op.ChecksumAlgo, false, rnd.Int63())
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, s *bench.Sample) error {
+			p, err := next()
+			if err != nil {
+				return err
+			}
+			payload := payloads.get()
+			user := env.users.get()
+			err = user.do(ctx, func(token string) error {
+				return uploadPayload(ctx, payload.Payload, p, token, payload.checksum)
+			})
+			if err != nil {
+				return err
+			}
+			env.created.add(user, p)
+			s.Bytes = payload.Size
+			return nil
+		}, nil
+
+	case "download":
+		return func(ctx context.Context, s *bench.Sample) error {
+			p, err := next()
+			if err != nil {
+				return err
+			}
+			return env.users.get().do(ctx, func(token string) error {
+				return downloadObject(ctx, &object{target: p, size: -1}, token, false, s)
+			})
+		}, nil
+
+	case "mkdir":
+		return func(ctx context.Context, s *bench.Sample) error {
+			p, err := next()
+			if err != nil {
+				return err
+			}
+			user := env.users.get()
+			err = user.do(ctx, func(token string) error {
+				in := &pb.MkdirReq{}
+				in.AccessToken = token
+				in.Path = p
+				_, err := env.meta.Mkdir(ctx, in)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			env.created.add(user, p)
+			return nil
+		}, nil
+
+	case "mv":
+		return func(ctx context.Context, s *bench.Sample) error {
+			src, ok := env.created.pop()
+			if !ok {
+				return errors.New("No resources left to move")
+			}
+			dst, err := next()
+			if err != nil {
+				env.created.add(src.user, src.path)
+				return err
+			}
+			err = src.user.do(ctx, func(token string) error {
+				in := &pb.MvReq{}
+				in.AccessToken = token
+				in.Src = src.path
+				in.Dst = dst
+				_, err := env.meta.Mv(ctx, in)
+				return err
+			})
+			if err != nil {
+				env.created.add(src.user, src.path)
+				return err
+			}
+			env.created.add(src.user, dst)
+			return nil
+		}, nil
+
+	case "rm":
+		return func(ctx context.Context, s *bench.Sample) error {
+			r, ok := env.created.pop()
+			if !ok {
+				return errors.New("No resources left to remove")
+			}
+			err := r.user.do(ctx, func(token string) error {
+				in := &pb.RmReq{}
+				in.AccessToken = token
+				in.Path = r.path
+				_, err := env.meta.Rm(ctx, in)
+				return err
+			})
+			if err != nil {
+				env.created.add(r.user, r.path)
+				return err
+			}
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown operation %q", op.Op)
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Help()
+		return nil
+	}
+
+	sc, err := readScenario(args[0])
+	if err != nil {
+		return err
+	}
+	if err := sc.apply(cmd); err != nil {
+		return err
+	}
+
+	users, err := getSessions()
+	if err != nil {
+		return err
+	}
+
+	con, err := dialPool(metaAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	env := &scenarioEnv{
+		users:   users,
+		meta:    metaClient{con},
+		created: &resourceList{},
+	}
+
+	type weightedOp struct {
+		name   string
+		weight int
+		do     func(ctx context.Context, s *bench.Sample) error
+	}
+
+	ops := []weightedOp{}
+	total := 0
+	for _, op := range sc.Operations {
+		do, err := env.newOp(op)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, weightedOp{name: op.Op, weight: op.Weight, do: do})
+		total += op.Weight
+	}
+
+	if cleanupFlag {
+		defer func() {
+			fmt.Fprintln(os.Stderr, "Removing created resources")
+			removeResources(env.meta, env.created.list())
+		}()
+	}
+
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		n := rnd.Intn(total)
+		for _, op := range ops {
+			if n < op.weight {
+				s.Op = op.name
+				return op.do(ctx, s)
+			}
+			n -= op.weight
+		}
+		return nil
+	})
+
+	columns := append([]bench.Column{bench.OpColumn}, bench.TransferColumns...)
+	_, err = runBenchmark(cmd, probe, columns)
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().BoolVar(&cleanupFlag, "cleanup", true, "Remove the resources created by the scenario after the benchmark")
+}
@@ -0,0 +1,37 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestScenarioApplySizesIdleConns(t *testing.T) {
+	concurrencyFlag = 1
+	idleConnsFlag = 0
+	initTransport()
+
+	sc := &scenario{Concurrency: 16}
+	if err := sc.apply(runCmd); err != nil {
+		t.Fatal(err)
+	}
+	if concurrencyFlag != 16 {
+		t.Errorf("concurrency = %d, want 16", concurrencyFlag)
+	}
+	if idle := dataClient.Transport.(*http.Transport).MaxIdleConnsPerHost; idle != 16 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want the concurrency of the scenario", idle)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/clawio/clawiobench/fakeserver"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var fakeAuthAddrFlag string
+var fakeMetaAddrFlag string
+var fakeDataAddrFlag string
+var fakeUsersFlag []string
+var fakeTokenTTLFlag time.Duration
+var fakeLatencyFlag time.Duration
+var fakeLatencyDistributionFlag string
+var fakeLatencySpreadFlag time.Duration
+var fakeErrorRateFlag float64
+var fakeUnavailableRateFlag float64
+var fakeUnauthenticatedRateFlag float64
+var fakeInsufficientStorageRateFlag float64
+var fakeResetRateFlag float64
+var fakeTruncateRateFlag float64
+var fakeCorruptRateFlag float64
+var fakeSlowBodyRateFlag float64
+var fakeSlowBodyDelayFlag time.Duration
+var fakeTLSCertFlag string
+var fakeTLSKeyFlag string
+var fakeTLSClientCAFlag string
+
+var serveFakeCmd = &cobra.Command{
+	Use:   "serve-fake",
+	Short: "Run in-memory fake ClawIO auth, meta and data units",
+	RunE:  serveFake,
+	Long: `This command runs in-memory stand-ins for the ClawIO auth, meta and
+data units, which allows trying clawiobench without a ClawIO deployment.
+Nothing is persisted.
+
+Latency and faults can be injected to check how clawiobench accounts
+errors and timeouts. The rates are fractions of requests between 0 and 1:
+
+    clawiobench serve-fake --latency 20ms --latency-distribution exponential \
+        --unavailable-rate 0.01 --reset-rate 0.005 --slow-body-rate 0.1
+
+With --truncate-rate and --corrupt-rate uploads are silently stored
+damaged, which the --verify option of upload and download detects.
+
+The units are served over TLS with --tls-cert and --tls-key, and require
+client certificates signed by --tls-client-ca if it is given.`,
+
+	// the fake units do not need the address of a ClawIO deployment
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+func serveFake(cmd *cobra.Command, args []string) error {
+	config := fakeserver.Config{
+		Users:                   map[string]string{},
+		TokenTTL:                fakeTokenTTLFlag,
+		Latency:                 fakeLatencyFlag,
+		LatencyDistribution:     fakeLatencyDistributionFlag,
+		LatencySpread:           fakeLatencySpreadFlag,
+		ErrorRate:               fakeErrorRateFlag,
+		UnavailableRate:         fakeUnavailableRateFlag,
+		UnauthenticatedRate:     fakeUnauthenticatedRateFlag,
+		InsufficientStorageRate: fakeInsufficientStorageRateFlag,
+		ResetRate:               fakeResetRateFlag,
+		TruncateRate:            fakeTruncateRateFlag,
+		CorruptRate:             fakeCorruptRateFlag,
+		SlowBodyRate:            fakeSlowBodyRateFlag,
+		SlowBodyDelay:           fakeSlowBodyDelayFlag,
+	}
+	switch config.LatencyDistribution {
+	case fakeserver.Constant, fakeserver.Uniform, fakeserver.Normal, fakeserver.Exponential:
+	default:
+		return fmt.Errorf("invalid latency distribution %q", config.LatencyDistribution)
+	}
+	for _, u := range fakeUsersFlag {
+		parts := strings.SplitN(u, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid user %q: it must be username:password", u)
+		}
+		config.Users[parts[0]] = parts[1]
+	}
+
+	scheme := "http"
+	if fakeTLSCertFlag != "" || fakeTLSKeyFlag != "" {
+		cert, err := tls.LoadX509KeyPair(fakeTLSCertFlag, fakeTLSKeyFlag)
+		if err != nil {
+			return err
+		}
+		config.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if fakeTLSClientCAFlag != "" {
+			pem, err := ioutil.ReadFile(fakeTLSClientCAFlag)
+			if err != nil {
+				return err
+			}
+			config.TLS.ClientCAs = x509.NewCertPool()
+			if !config.TLS.ClientCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in %s", fakeTLSClientCAFlag)
+			}
+			config.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		scheme = "https"
+		fmt.Println("export CLAWIO_BENCH_TLS=true")
+	}
+
+	fmt.Printf("export CLAWIO_BENCH_AUTH_ADDR=%s\n", fakeAuthAddrFlag)
+	fmt.Printf("export CLAWIO_BENCH_META_ADDR=%s\n", fakeMetaAddrFlag)
+	fmt.Printf("export CLAWIO_BENCH_DATA_ADDR=%s://%s\n", scheme, fakeDataAddrFlag)
+
+	srv := fakeserver.New(config)
+	return srv.ListenAndServe(fakeAuthAddrFlag, fakeMetaAddrFlag, fakeDataAddrFlag)
+}
+
+func init() {
+	RootCmd.AddCommand(serveFakeCmd)
+
+	serveFakeCmd.Flags().StringVar(&fakeAuthAddrFlag, "auth-addr", "localhost:57000", "Address of the fake auth unit")
+	serveFakeCmd.Flags().StringVar(&fakeMetaAddrFlag, "meta-addr", "localhost:57001", "Address of the fake meta unit")
+	serveFakeCmd.Flags().StringVar(&fakeDataAddrFlag, "data-addr", "localhost:57002", "Address of the fake data unit")
+	serveFakeCmd.Flags().StringSliceVar(&fakeUsersFlag, "user", nil, "Accepted credentials as username:password. The default is to accept any credentials.")
+	serveFakeCmd.Flags().DurationVar(&fakeTokenTTLFlag, "token-ttl", 0, "Lifetime of the issued tokens. The default is that they never expire.")
+	serveFakeCmd.Flags().DurationVar(&fakeLatencyFlag, "latency", 0, "Mean latency added to every request")
+	serveFakeCmd.Flags().StringVar(&fakeLatencyDistributionFlag, "latency-distribution", fakeserver.Constant, "Distribution of the latency: constant, uniform, normal or exponential")
+	serveFakeCmd.Flags().DurationVar(&fakeLatencySpreadFlag, "latency-spread", 0, "Half width of the uniform latency or standard deviation of the normal latency")
+	serveFakeCmd.Flags().Float64Var(&fakeErrorRateFlag, "error-rate", 0, "Fraction of requests that fail with an internal error (codes.Internal or HTTP 500)")
+	serveFakeCmd.Flags().Float64Var(&fakeUnavailableRateFlag, "unavailable-rate", 0, "Fraction of gRPC requests that fail with codes.Unavailable")
+	serveFakeCmd.Flags().Float64Var(&fakeUnauthenticatedRateFlag, "unauthenticated-rate", 0, "Fraction of requests rejected with codes.Unauthenticated or HTTP 401")
+	serveFakeCmd.Flags().Float64Var(&fakeInsufficientStorageRateFlag, "insufficient-storage-rate", 0, "Fraction of uploads that fail with HTTP 507")
+	serveFakeCmd.Flags().Float64Var(&fakeResetRateFlag, "reset-rate", 0, "Fraction of HTTP requests whose connection is reset")
+	serveFakeCmd.Flags().Float64Var(&fakeTruncateRateFlag, "truncate-rate", 0, "Fraction of uploads of which only the first half is stored")
+	serveFakeCmd.Flags().Float64Var(&fakeCorruptRateFlag, "corrupt-rate", 0, "Fraction of uploads stored with their first byte altered")
+	serveFakeCmd.Flags().Float64Var(&fakeSlowBodyRateFlag, "slow-body-rate", 0, "Fraction of HTTP requests whose body is transferred slowly")
+	serveFakeCmd.Flags().DurationVar(&fakeSlowBodyDelayFlag, "slow-body-delay", 100*time.Millisecond, "Pause between the 64KB chunks of slow bodies")
+	serveFakeCmd.Flags().StringVar(&fakeTLSCertFlag, "tls-cert", "", "PEM file with the certificate of the units")
+	serveFakeCmd.Flags().StringVar(&fakeTLSKeyFlag, "tls-key", "", "PEM file with the key of the certificate of the units")
+	serveFakeCmd.Flags().StringVar(&fakeTLSClientCAFlag, "tls-client-ca", "", "PEM file with the CA certificates of the accepted client certificates")
+}
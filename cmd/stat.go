@@ -15,14 +15,10 @@
 package cmd
 
 import (
-	"encoding/csv"
-	"fmt"
-	br "github.com/cheggaaa/pb"
+	"github.com/clawio/clawiobench/bench"
 	pb "github.com/clawio/clawiobench/proto/metadata"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
-	"google.golang.org/grpc"
-	"time"
 )
 
 var childrenFlag bool
@@ -40,108 +36,32 @@ func stat(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	token, err := getToken()
+	users, err := getSessions()
 	if err != nil {
 		return err
 	}
 
-	con, err := grpc.Dial(metaAddr, grpc.WithInsecure())
+	con, err := dialPool(metaAddr)
 	if err != nil {
 		return err
 	}
 	defer con.Close()
 
-	c := pb.NewMetaClient(con)
+	c := metaClient{con}
 
-	benchStart := time.Now()
-
-	total := 0
-	errorProbes := 0
-
-	errChan := make(chan error)
-	resChan := make(chan string)
-	doneChan := make(chan bool)
-	limitChan := make(chan int, concurrencyFlag)
-
-	for i := 0; i < concurrencyFlag; i++ {
-		limitChan <- 1
-	}
-
-	var bar *br.ProgressBar
-	if progressBar {
-		bar = br.StartNew(probesFlag)
-	}
-
-	for i := 0; i < probesFlag; i++ {
-		go func() {
-			<-limitChan
-			defer func() {
-				limitChan <- 1
-			}()
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		return users.get().do(ctx, func(token string) error {
 			in := &pb.StatReq{}
 			in.AccessToken = token
 			in.Path = args[0]
 			in.Children = childrenFlag
-			ctx := context.Background()
 			_, err := c.Stat(ctx, in)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			doneChan <- true
-			resChan <- ""
-		}()
-	}
-
-	for {
-		select {
-		case _ = <-doneChan:
-			total++
-			if progressBar {
-				bar.Increment()
-			}
-		case _ = <-resChan:
-		case err := <-errChan:
-			log.Error(err)
-			errorProbes++
-			total++
-			if progressBar {
-				bar.Increment()
-			}
-		}
-		if total == probesFlag {
-			break
-		}
-	}
-
-	if progressBar {
-		bar.Finish()
-	}
-
-	numberRequests := probesFlag
-	concurrency := concurrencyFlag
-	totalTime := time.Since(benchStart).Seconds()
-	failedRequests := errorProbes
-	frequency := float64(numberRequests-failedRequests) / totalTime
-	period := float64(1 / frequency)
-
-	data := [][]string{
-		{"#NUMBER", "CONCURRENCY", "TIME", "FAILED", "FREQ", "PERIOD"},
-		{fmt.Sprintf("%d", numberRequests), fmt.Sprintf("%d", concurrency), fmt.Sprintf("%f", totalTime), fmt.Sprintf("%d", failedRequests), fmt.Sprintf("%f", frequency), fmt.Sprintf("%f", period)},
-	}
-	w := csv.NewWriter(output)
-	w.Comma = ' '
-	for _, d := range data {
-		if err := w.Write(d); err != nil {
 			return err
-		}
-	}
-	w.Flush()
+		})
+	})
 
-	if err := w.Error(); err != nil {
-		return err
-	}
-	return nil
+	_, err = runBenchmark(cmd, probe, nil)
+	return err
 }
 
 func init() {
@@ -0,0 +1,105 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var tlsFlag bool
+var caCertFlag string
+var clientCertFlag string
+var clientKeyFlag string
+var insecureSkipVerifyFlag bool
+
+// tlsEnabled, caCert, clientCert, clientKey and insecureSkipVerify are the
+// TLS settings taken from the flags, the profile in use or the environment.
+var tlsEnabled bool
+var caCert string
+var clientCert string
+var clientKey string
+var insecureSkipVerify bool
+
+// tlsConfig is the TLS configuration of the connections to ClawIO. It is
+// nil when TLS is disabled.
+var tlsConfig *tls.Config
+
+// initTLS builds the TLS configuration shared by the connections to the
+// auth, meta and data units. The TLS flags override the settings of the
+// profile. Unless --tls is given, setting a certificate or skipping their
+// verification implies it.
+func initTLS() error {
+	flags := RootCmd.PersistentFlags()
+	if flags.Lookup("ca-cert").Changed {
+		caCert = caCertFlag
+	}
+	if flags.Lookup("client-cert").Changed {
+		clientCert = clientCertFlag
+	}
+	if flags.Lookup("client-key").Changed {
+		clientKey = clientKeyFlag
+	}
+	if flags.Lookup("insecure-skip-verify").Changed {
+		insecureSkipVerify = insecureSkipVerifyFlag
+	}
+	if flags.Lookup("tls").Changed {
+		tlsEnabled = tlsFlag
+	} else if caCert != "" || clientCert != "" || clientKey != "" || insecureSkipVerify {
+		tlsEnabled = true
+	}
+
+	if !tlsEnabled {
+		return nil
+	}
+
+	if dataAddr != "" && !strings.HasPrefix(dataAddr, "https://") {
+		return fmt.Errorf("The data unit address %s must be https with TLS", dataAddr)
+	}
+
+	tlsConfig = &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return fmt.Errorf("Cannot read the CA certificate: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No certificates found in %s", caCert)
+		}
+	}
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return fmt.Errorf("The client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return fmt.Errorf("Cannot load the client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&tlsFlag, "tls", false, "Use TLS to connect to the auth, meta and data units. The data unit address must be https.")
+	RootCmd.PersistentFlags().StringVar(&caCertFlag, "ca-cert", "", "PEM file with the CA certificates used to verify the servers instead of the system ones")
+	RootCmd.PersistentFlags().StringVar(&clientCertFlag, "client-cert", "", "PEM file with the client certificate for mutual TLS")
+	RootCmd.PersistentFlags().StringVar(&clientKeyFlag, "client-key", "", "PEM file with the key of the client certificate")
+	RootCmd.PersistentFlags().BoolVar(&insecureSkipVerifyFlag, "insecure-skip-verify", false, "Do not verify the certificates of the servers")
+}
@@ -0,0 +1,53 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestInitTLSImplied(t *testing.T) {
+	flags := RootCmd.PersistentFlags()
+	defer func() {
+		flags.Set("tls", "false")
+		flags.Lookup("tls").Changed = false
+		tlsEnabled, insecureSkipVerify, tlsConfig = false, false, nil
+	}()
+
+	tests := []struct {
+		flag string
+		want bool
+	}{
+		{"", true},
+		{"false", false},
+		{"true", true},
+	}
+	for _, tt := range tests {
+		flags.Lookup("tls").Changed = false
+		if tt.flag != "" {
+			flags.Set("tls", tt.flag)
+		}
+		tlsEnabled, insecureSkipVerify, tlsConfig = false, true, nil
+		dataAddr = "https://localhost:57002"
+
+		if err := initTLS(); err != nil {
+			t.Errorf("--tls=%q: initTLS returned error %v", tt.flag, err)
+			continue
+		}
+		if tlsEnabled != tt.want || (tlsConfig != nil) != tt.want {
+			t.Errorf("--tls=%q with a profile that skips the verification: TLS = %v, want %v", tt.flag, tlsEnabled, tt.want)
+		}
+	}
+}
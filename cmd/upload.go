@@ -15,25 +15,28 @@
 package cmd
 
 import (
-	"bytes"
-	"encoding/csv"
+	"crypto/md5"
 	"fmt"
-	"github.com/cheggaaa/pb"
-	"github.com/nu7hatch/gouuid"
+	"github.com/clawio/clawiobench/bench"
+	pb "github.com/clawio/clawiobench/proto/metadata"
 	"github.com/spf13/cobra"
-	"io/ioutil"
-	"math/rand"
+	"golang.org/x/net/context"
+	"io"
 	"net/http"
-	"os"
-	"path"
+	"strings"
 	"time"
 )
 
 var countFlag int
 var bsFlag int
 var checksumFlag string
+var checksumAlgoFlag string
 var cernDistributionFlag bool
+var sizeDistributionFlag string
 var randomTargetFlag bool
+var payloadFlag string
+var compressibleRatioFlag float64
+var verifyUploadFlag string
 
 var uploadCmd = &cobra.Command{
 	Use:   "upload",
@@ -42,152 +45,224 @@ var uploadCmd = &cobra.Command{
 	Long: `This benchmark test will measure the upload performance.
 
 The object size is the result of block size x count. This is the same
-approach used by dd.`,
+approach used by dd. The content of the objects is generated while it is
+uploaded, so no local files are created.
+
+With --size-distribution the size of every object is drawn from a
+distribution instead: "cern" is the distribution found on CERNBox,
+"uniform:1KB,10MB" draws sizes uniformly between the bounds,
+"lognormal:1MB,1.5" from a log-normal distribution with the given median
+and shape, and any other value is read as a file of size,weight lines:
+
+    # size,weight
+    4KB,60
+    1MB,30
+    100MB,10
+
+The uniform and lognormal distributions are sampled before the benchmark:
+the objects have one of 100 sizes drawn from them, so that their content
+and checksum can be prepared beforehand.
+
+With --checksum-algo the checksum of every object is computed before the
+benchmark and sent in the CIO-Checksum header as algo:value, so the cost
+of its verification by the server is part of the measurement.
+
+With --verify every upload is followed by a stat of the object, which
+must have the size and checksum that were sent, by a download of the
+object, which must return the uploaded content, or by both of them with
+--verify=all. Mismatches are reported as integrity errors and failures of
+the stat or the download in the error classes prefixed with "verify:".
+The time spent verifying is not part of the latency of the uploads, it is
+reported in the VERIFY columns.
+
+The volume and throughput are computed from the size of the objects
+uploaded successfully and FREQ is the number of objects uploaded per
+second. Unless all the objects have the same size the results are also
+broken down by size.`,
 }
 
-// createFile is a substitute for dd
-// char is the character to insert
-// count is the number of blocks
-// bs is the block size: how many bytes are we going to write flush every round.
-func createFile(fn, char string, count, bs int) (*os.File, error) {
-	var fd *os.File
-	if fn == "" {
-		tf, err := ioutil.TempFile("", "CLAWIOBENCH-")
-		if err != nil {
-			return nil, err
-		}
-		fd = tf
-	} else {
-		tf, err := os.Create(path.Join(os.TempDir(), fn))
-		if err != nil {
-			log.Error(err)
-			return nil, err
-		}
-		fd = tf
+// sizeDistribution returns the distribution of object sizes given by spec,
+// the CERN distribution if cern is set or the size of count blocks of bs
+// bytes.
+func sizeDistribution(spec string, cern bool, count, bs int) (bench.SizeDistribution, error) {
+	if spec != "" {
+		return bench.ParseSizeDistribution(spec)
 	}
-
-	// if char is 1 byte then the buffer size will be equal to bs
-	buffer := bytes.Repeat([]byte(char), bs)
-
-	for i := 0; i < count; i++ {
-		_, err := fd.Write(buffer)
-		if err != nil {
-			return nil, err
-		}
+	if cern {
+		return bench.CERNDistribution(), nil
 	}
+	return bench.FixedSize(int64(count) * int64(bs)), nil
+}
 
-	return fd, nil
+// testPayload is a payload uploaded by the benchmarks, its checksum and the
+// md5 of its content used for verification.
+type testPayload struct {
+	bench.Payload
+	checksum string
+	md5      string
 }
 
-// This is the distribution of files at CERN
-func createCERNDistribution() ([]string, error) {
-	fds := []*os.File{}
-	fns := []string{}
-	fd50MB, err := createFile("testfile-50MB", "1", 1024, 1024*50)
-	if err != nil {
-		return fns, err
-	}
-	fds = append(fds, fd50MB)
+// preparedSizes is the number of sizes drawn from continuous size
+// distributions before a benchmark.
+const preparedSizes = 100
+
+// payloadSet holds the payloads of a benchmark, whose checksums are
+// computed before it starts. For discrete size distributions there is a
+// payload of every size, picked according to the weights, otherwise
+// preparedSizes sizes are drawn from the distribution and picked uniformly.
+type payloadSet struct {
+	payloads []*testPayload
+	pick     func() int
+}
 
-	fd15MB, err := createFile("testfile-15MB", "1", 1024, 1024*15)
-	if err != nil {
-		return fns, err
+// newPayloadSet returns the payloads like template with the sizes of dist.
+// Their checksums are computed with algo and, if md5 is set, with md5 too.
+func newPayloadSet(template bench.Payload, dist bench.SizeDistribution, algo string, md5 bool, seed int64) (*payloadSet, error) {
+	if err := bench.CheckPayloadKind(template.Kind); err != nil {
+		return nil, err
 	}
-	fds = append(fds, fd15MB)
-
-	fd8MB, err := createFile("testfile-8MB", "1", 1024, 1024*8)
-	if err != nil {
-		return fns, err
+	if _, err := bench.NewHash(algo); err != nil {
+		return nil, err
 	}
-	fds = append(fds, fd8MB)
 
-	fd10MB, err := createFile("testfile-8MB", "1", 1024, 1024*10)
-	if err != nil {
-		return fns, err
+	ps := &payloadSet{}
+	var sizes []int64
+	if ws, ok := dist.(*bench.WeightedSizes); ok {
+		sizes = ws.Sizes
+		ps.pick = func() int { return ws.Index(rnd) }
+	} else {
+		for i := 0; i < preparedSizes; i++ {
+			sizes = append(sizes, dist.Sample(rnd))
+		}
+		ps.pick = func() int { return rnd.Intn(len(sizes)) }
 	}
-	fds = append(fds, fd10MB)
 
-	fd5MB, err := createFile("testfile-5MB", "1", 1024, 1024*5)
-	if err != nil {
-		return fns, err
+	computed := map[int64]*testPayload{}
+	for _, size := range sizes {
+		tp, ok := computed[size]
+		if !ok {
+			var err error
+			tp, err = newTestPayload(template, size, seed, algo, md5)
+			if err != nil {
+				return nil, err
+			}
+			computed[size] = tp
+		}
+		ps.payloads = append(ps.payloads, tp)
 	}
-	fds = append(fds, fd5MB)
+	return ps, nil
+}
 
-	fd4MB, err := createFile("testfile-4MB", "1", 1024, 1024*4)
+// newTestPayload returns the payload like template of the given size and
+// computes its checksums.
+func newTestPayload(template bench.Payload, size, seed int64, algo string, withMD5 bool) (*testPayload, error) {
+	p := template
+	p.Size = size
+	p.Seed = seed + size
+	checksum, err := bench.Checksum(algo, p.Reader())
 	if err != nil {
-		return fns, err
+		return nil, err
+	}
+	tp := &testPayload{Payload: p, checksum: checksum}
+	if withMD5 {
+		h := md5.New()
+		if _, err := io.Copy(h, p.Reader()); err != nil {
+			return nil, err
+		}
+		tp.md5 = fmt.Sprintf("%x", h.Sum(nil))
 	}
-	fds = append(fds, fd4MB)
+	return tp, nil
+}
+
+// get returns the payload of the next request.
+func (ps *payloadSet) get() *testPayload {
+	return ps.payloads[ps.pick()]
+}
+
+// flagPayload returns the payload described by the --payload flags.
+func flagPayload() bench.Payload {
+	return bench.Payload{Kind: payloadFlag, Ratio: compressibleRatioFlag}
+}
 
-	fd3MB, err := createFile("testfile-3MB", "1", 1024, 1024*3)
+// uploadPayload streams p to target in the data unit. The request is
+// cancelled when ctx is done.
+func uploadPayload(ctx context.Context, p bench.Payload, target, token, checksum string) error {
+	req, err := http.NewRequest("PUT", dataAddr+target, p.Reader())
 	if err != nil {
-		return fns, err
+		return err
 	}
-	fds = append(fds, fd3MB)
+	req.ContentLength = p.Size
 
-	fd2MB, err := createFile("testfile-2MB", "1", 1024, 1024*2)
+	req.Header.Add("Content-Type", "application/octet-stream")
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("CIO-Checksum", checksum)
+	req.Cancel = ctx.Done()
+
+	res, err := dataClient.Do(req)
 	if err != nil {
-		return fns, err
+		return err
 	}
-	fds = append(fds, fd2MB)
 
-	fd1MB, err := createFile("testfile-1MB", "1", 1024, 1024)
+	err = res.Body.Close()
 	if err != nil {
-		return fns, err
+		return err
 	}
-	fds = append(fds, fd1MB)
 
-	for i := 0; i < 11; i++ {
-		fn := fmt.Sprintf("testfile-500KB-%d", i)
-		fd, err := createFile(fn, "1", 1024, 500)
-		if err != nil {
-			return fns, err
-		}
-		fds = append(fds, fd)
+	if res.StatusCode != 201 {
+		return &statusError{code: res.StatusCode}
 	}
 
-	for i := 0; i < 32; i++ {
-		fn := fmt.Sprintf("testfile-50KB-%d", i)
-		fd, err := createFile(fn, "1", 1024, 50)
-		if err != nil {
-			return fns, err
-		}
-		fds = append(fds, fd)
-	}
+	return nil
+}
 
-	for i := 0; i < 28; i++ {
-		fn := fmt.Sprintf("testfile-5KB-%d", i)
-		fd, err := createFile(fn, "1", 1024, 5)
-		if err != nil {
-			return fns, err
-		}
-		fds = append(fds, fd)
-	}
+// Modes of upload verification.
+const (
+	verifyStat = "stat"
+	verifyGet  = "get"
+	verifyAll  = "all"
+)
 
-	for i := 0; i < 15; i++ {
-		fn := fmt.Sprintf("testfile-1KB-%d", i)
-		fd, err := createFile(fn, "1", 1024, 1)
+// verifyUpload checks that p was stored at target. With verifyStat or
+// verifyAll the size and checksum of the object are checked with a stat,
+// checksum being the one sent with the upload. With verifyGet or verifyAll
+// the object is downloaded and compared with p.
+func verifyUpload(ctx context.Context, meta pb.MetaClient, p *testPayload, target, token, checksum, mode string) error {
+	if mode == verifyStat || mode == verifyAll {
+		in := &pb.StatReq{}
+		in.AccessToken = token
+		in.Path = target
+		mt, err := meta.Stat(ctx, in)
 		if err != nil {
-			return fns, err
+			return err
+		}
+		if mt.Size != uint32(p.Size) {
+			return newIntegrityError("Stat of %s returned size %d but %d bytes were uploaded", target, mt.Size, p.Size)
 		}
-		fds = append(fds, fd)
-	}
 
-	for i := 0; i < 5; i++ {
-		fn := fmt.Sprintf("testfile-100B-%d", i)
-		fd, err := createFile(fn, "1", 1, 100)
-		if err != nil {
-			return fns, err
+		expected := checksum
+		if expected == "" && mt.Checksum != "" {
+			algo := strings.SplitN(mt.Checksum, ":", 2)[0]
+			if algo == bench.ChecksumMD5 && p.md5 != "" {
+				expected = "md5:" + p.md5
+			} else if _, err := bench.NewHash(algo); err == nil {
+				expected, err = bench.Checksum(algo, p.Reader())
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if expected != "" && mt.Checksum != expected {
+			return newIntegrityError("Stat of %s returned checksum %s but %s was expected", target, mt.Checksum, expected)
 		}
-		fds = append(fds, fd)
 	}
 
-	for _, v := range fds {
-		fns = append(fns, v.Name())
-		v.Close()
+	if mode == verifyGet || mode == verifyAll {
+		obj := &object{target: target, size: p.Size, md5: p.md5}
+		if err := downloadObject(ctx, obj, token, true, &bench.Sample{}); err != nil {
+			return err
+		}
 	}
-
-	return fns, nil
+	return nil
 }
 
 func upload(cmd *cobra.Command, args []string) error {
@@ -196,175 +271,104 @@ func upload(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if concurrencyFlag > probesFlag {
-		concurrencyFlag = probesFlag
-	}
-	if concurrencyFlag == 0 {
-		concurrencyFlag++
-	}
-
-	token, err := getToken()
+	users, err := getSessions()
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	var fns []string
-	if cernDistributionFlag {
-		vals, err := createCERNDistribution()
-		if err != nil {
-			return err
-		}
-		fns = vals
-	} else {
-		fd, err := createFile(fmt.Sprintf("testfile-manual-count-%d-bs-%d", countFlag, bsFlag), "1", countFlag, bsFlag)
+	var meta pb.MetaClient
+	switch verifyUploadFlag {
+	case "":
+	case verifyStat, verifyGet, verifyAll:
+		con, err := dialPool(metaAddr)
 		if err != nil {
+			log.Error(err)
 			return err
 		}
-		fns = []string{fd.Name()}
-		fd.Close()
+		defer con.Close()
+		meta = metaClient{con}
+	default:
+		return fmt.Errorf("invalid verification %q: it must be stat, get or all", verifyUploadFlag)
 	}
 
-	defer func() {
-		for _, v := range fns {
-			os.RemoveAll(v)
-		}
-	}()
-
-	benchStart := time.Now()
-
-	total := 0
-	errorProbes := 0
-
-	errChan := make(chan error)
-	resChan := make(chan string)
-	doneChan := make(chan bool)
-	limitChan := make(chan int, concurrencyFlag)
-
-	for i := 0; i < concurrencyFlag; i++ {
-		limitChan <- 1
+	dist, err := sizeDistribution(sizeDistributionFlag, cernDistributionFlag, countFlag, bsFlag)
+	if err != nil {
+		return err
 	}
-
-	var bar *pb.ProgressBar
-	if progressBar {
-		fmt.Printf("There are %d possible files to upload\n", len(fns))
-		bar = pb.StartNew(probesFlag)
+	verifyGet := verifyUploadFlag == verifyGet || verifyUploadFlag == verifyAll
+	payloads, err := newPayloadSet(flagPayload(), dist, checksumAlgoFlag, verifyGet, rnd.Int63())
+	if err != nil {
+		return err
 	}
 
-	for i := 0; i < probesFlag; i++ {
-		rand.Seed(time.Now().UnixNano())
-		filename := fns[rand.Intn(len(fns))]
-		go func(fn string) {
-			<-limitChan
-			defer func() {
-				limitChan <- 1
-			}()
-
-			// open again the file
-			lfd, err := os.Open(fn)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			defer lfd.Close()
-
-			c := &http.Client{} // connections are reused if we reuse the client
-			// PUT will close the fd
-			// is it possible that the HTTP client is reusing connections so is being blocked?
-			target := args[0]
-			if randomTargetFlag {
-				rawUUID, err := uuid.NewV4()
-				if err != nil {
-					errChan <- err
-					return
-				}
-				target += rawUUID.String()
-			}
-			req, err := http.NewRequest("PUT", dataAddr+target, lfd)
-			if err != nil {
-				errChan <- err
-				return
-			}
+	// results are broken down by size bucket unless all objects have
+	// the same size
+	buckets := true
+	if ws, ok := dist.(*bench.WeightedSizes); ok && len(ws.Sizes) == 1 {
+		buckets = false
+	}
 
-			req.Header.Add("Content-Type", "application/octet-stream")
-			req.Header.Add("Authorization", "Bearer "+token)
-			req.Header.Add("CIO-Checksum", checksumFlag)
+	probe := bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		p := payloads.get()
+		if buckets {
+			s.Bucket = bench.SizeBucket(p.Size)
+		}
 
-			res, err := c.Do(req)
+		var err error
+		target := args[0]
+		if randomTargetFlag {
+			target, err = uniquePath(target)
 			if err != nil {
-				errChan <- err
-				return
+				return err
 			}
+		}
 
-			err = res.Body.Close()
+		user := users.get()
+		checksum := p.checksum
+		if checksumFlag != "" {
+			checksum = checksumFlag
+		}
+		err = user.do(ctx, func(token string) error {
+			return uploadPayload(ctx, p.Payload, target, token, checksum)
+		})
+		if err != nil {
+			return err
+		}
+		if verifyUploadFlag != "" {
+			start := time.Now()
+			err = user.do(ctx, func(token string) error {
+				return verifyUpload(ctx, meta, p, target, token, checksum, verifyUploadFlag)
+			})
+			s.Verify = time.Since(start)
 			if err != nil {
-				errChan <- err
-				return
-			}
-
-			if res.StatusCode != 201 {
-				err := fmt.Errorf("Request failed with status code %d", res.StatusCode)
-				errChan <- err
-				return
-			}
-
-			doneChan <- true
-			resChan <- ""
-			return
-		}(filename)
-	}
-
-	for {
-		select {
-		case _ = <-doneChan:
-			total++
-			if progressBar {
-				bar.Increment()
-			}
-		case _ = <-resChan:
-		case err := <-errChan:
-			log.Error(err)
-			errorProbes++
-			total++
-			if progressBar {
-				bar.Increment()
+				if bench.ClassifyError(err) != bench.ErrorIntegrity {
+					err = &verificationError{err: err}
+				}
+				return err
 			}
 		}
+		s.Bytes = p.Size
+		return nil
+	})
 
-		if total == probesFlag {
-			break
-		}
-	}
-
-	if progressBar {
-		bar.Finish()
-	}
-
-	numberRequests := probesFlag
-	concurrency := concurrencyFlag
-	totalTime := time.Since(benchStart).Seconds()
-	failedRequests := errorProbes
-	frequency := float64(numberRequests-failedRequests) / totalTime
-	period := float64(1 / frequency)
-	volume := numberRequests * countFlag * bsFlag / 1024 / 1024
-	throughput := float64(volume) / totalTime
-	data := [][]string{
-		{"#NUMBER", "CONCURRENCY", "TIME", "FAILED", "FREQ", "PERIOD", "VOLUME", "THROUGHPUT"},
-		{fmt.Sprintf("%d", numberRequests), fmt.Sprintf("%d", concurrency), fmt.Sprintf("%f", totalTime), fmt.Sprintf("%d", failedRequests), fmt.Sprintf("%f", frequency), fmt.Sprintf("%f", period), fmt.Sprintf("%d", volume), fmt.Sprintf("%f", throughput)},
+	columns := append([]bench.Column{}, bench.VolumeColumns...)
+	if buckets {
+		columns = append(columns, bench.BucketColumn)
 	}
-	w := csv.NewWriter(output)
-	w.Comma = ' '
-	for _, d := range data {
-		if err := w.Write(d); err != nil {
-			return err
-		}
+	if verifyUploadFlag != "" {
+		columns = append(columns, bench.VerifyColumns...)
+		columns = append(columns, bench.Column{Name: "INTEGRITY", Value: func(res *bench.Result) string {
+			n := 0
+			if class, ok := res.Errors[bench.ErrorIntegrity]; ok {
+				n = class.Count
+			}
+			return fmt.Sprintf("%d", n)
+		}})
 	}
-	w.Flush()
 
-	if err := w.Error(); err != nil {
-		return err
-	}
-	return nil
+	_, err = runBenchmark(cmd, probe, columns)
+	return err
 }
 
 func init() {
@@ -382,8 +386,14 @@ func init() {
 
 	uploadCmd.Flags().IntVar(&countFlag, "count", 1024, "The number of blocks of the file")
 	uploadCmd.Flags().IntVar(&bsFlag, "bs", 1024, "The number of bytes of each block")
-	uploadCmd.Flags().StringVar(&checksumFlag, "checksum", "", "The checksum for the file")
-	uploadCmd.Flags().BoolVar(&cernDistributionFlag, "cern-distribution", false, "Use file sizes that follow the distribution found on CERNBox")
+	uploadCmd.Flags().StringVar(&checksumFlag, "checksum", "", "The checksum sent for every file instead of the one computed with --checksum-algo")
+	uploadCmd.Flags().StringVar(&checksumAlgoFlag, "checksum-algo", bench.ChecksumNone, "Compute the checksum sent for every file: md5, sha1, adler32 or none")
+	uploadCmd.Flags().BoolVar(&cernDistributionFlag, "cern-distribution", false, "Use file sizes that follow the distribution found on CERNBox, like --size-distribution cern")
+	uploadCmd.Flags().StringVar(&sizeDistributionFlag, "size-distribution", "", "Distribution of the file sizes: cern, uniform[:MIN,MAX], lognormal[:MEDIAN,SIGMA] or a file of size,weight lines")
 	uploadCmd.Flags().BoolVar(&randomTargetFlag, "random-target", false, "Add a random value to the upload target filename")
+	uploadCmd.Flags().StringVar(&payloadFlag, "payload", bench.PayloadConstant, "Content of the objects: constant, random or compressible")
+	uploadCmd.Flags().Float64Var(&compressibleRatioFlag, "compressible-ratio", 0.5, "Fraction of constant content of compressible objects")
+	uploadCmd.Flags().StringVar(&verifyUploadFlag, "verify", "", "Verify every upload with a stat, a download (get) or both (all)")
+	uploadCmd.Flags().Lookup("verify").NoOptDefVal = verifyStat
 
 }
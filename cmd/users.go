@@ -0,0 +1,277 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	authpb "github.com/clawio/clawiobench/proto/auth"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var usersFlag string
+var createHomesFlag bool
+var reloginFlag bool
+
+// session is a user on whose behalf requests are made.
+type session struct {
+	username string
+	// password is used to log in again when the token is rejected. It is
+	// empty if it is not known.
+	password string
+
+	mu    sync.Mutex
+	token string
+}
+
+// getToken returns the current token of the session.
+func (s *session) getToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// do calls f with the token of the session. With --relogin, if the server
+// rejects the token the user logs in again and f is retried once.
+func (s *session) do(ctx context.Context, f func(token string) error) error {
+	token := s.getToken()
+	err := f(token)
+	if err == nil || !reloginFlag || !isUnauthenticated(err) {
+		return err
+	}
+	if err := s.relogin(ctx, token); err != nil {
+		return err
+	}
+	return f(s.getToken())
+}
+
+// relogin replaces the stale token of the session with a new one, unless
+// another request already did it.
+func (s *session) relogin(ctx context.Context, stale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != stale {
+		return nil
+	}
+	if s.username == "" || s.password == "" {
+		return fmt.Errorf("Cannot login again: the credentials are not configured")
+	}
+
+	con, err := dial(authAddr)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	in := &authpb.AuthRequest{}
+	in.Username = s.username
+	in.Password = s.password
+	res, err := authpb.NewAuthClient(con).Authenticate(ctx, in)
+	if err != nil {
+		return fmt.Errorf("Cannot login again as %s: %s", s.username, err)
+	}
+	s.token = res.Token
+	return nil
+}
+
+// isUnauthenticated reports whether err is the rejection of a token by the
+// metadata or the data unit.
+func isUnauthenticated(err error) bool {
+	switch bench.ClassifyError(err) {
+	case "grpc:" + codes.Unauthenticated.String(), "http:401":
+		return true
+	}
+	return false
+}
+
+// sessionPool distributes the requests of a benchmark among its users.
+type sessionPool struct {
+	sessions []*session
+	next     uint64
+}
+
+// get returns the session of the next request. Sessions are handed out in
+// rotation.
+func (p *sessionPool) get() *session {
+	i := atomic.AddUint64(&p.next, 1) - 1
+	return p.sessions[i%uint64(len(p.sessions))]
+}
+
+// getSessions returns the users of a benchmark. With --users every user of
+// the file is authenticated before the benchmark and, with --create-homes,
+// gets its home directory created. Otherwise the only user is the one
+// logged in with the login command, whose credentials for --relogin are
+// taken from the configuration or the profile in use.
+func getSessions() (*sessionPool, error) {
+	if usersFlag == "" {
+		token, err := getToken()
+		if err != nil {
+			return nil, err
+		}
+		s := &session{username: username, password: password, token: token}
+		pool := &sessionPool{sessions: []*session{s}}
+		checkExpiry(pool)
+		return pool, nil
+	}
+
+	creds, err := readCredentials(usersFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := dial(authAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer con.Close()
+	c := authpb.NewAuthClient(con)
+
+	var meta pb.MetaClient
+	if createHomesFlag {
+		metaCon, err := dial(metaAddr)
+		if err != nil {
+			return nil, err
+		}
+		defer metaCon.Close()
+		meta = pb.NewMetaClient(metaCon)
+	}
+
+	sessions := make([]*session, len(creds))
+	var next uint64
+	var mu sync.Mutex
+	var firstErr error
+	res := runQuiet(len(creds), bench.ProbeFunc(func(ctx context.Context, s *bench.Sample) error {
+		i := atomic.AddUint64(&next, 1) - 1
+		cred := creds[i]
+		err := func() error {
+			in := &authpb.AuthRequest{}
+			in.Username = cred.username
+			in.Password = cred.password
+			res, err := c.Authenticate(ctx, in)
+			if err != nil {
+				return err
+			}
+			sessions[i] = &session{username: cred.username, password: cred.password, token: res.Token}
+
+			if meta != nil {
+				in := &pb.HomeReq{}
+				in.AccessToken = res.Token
+				if _, err := meta.Home(ctx, in); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			err = fmt.Errorf("Cannot prepare user %s: %s", cred.username, err)
+			log.Error(err)
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+		return err
+	}))
+	if res.Failed > 0 {
+		return nil, firstErr
+	}
+
+	if progressBar {
+		fmt.Fprintf(os.Stderr, "Prepared %d users\n", len(sessions))
+	}
+	pool := &sessionPool{sessions: sessions}
+	checkExpiry(pool)
+	return pool, nil
+}
+
+// checkExpiry warns about the users whose token has expired or expires
+// before the end of a benchmark with a known duration, unless --relogin is
+// set.
+func checkExpiry(pool *sessionPool) {
+	if reloginFlag {
+		return
+	}
+
+	now := time.Now()
+	end := now
+	if durationFlag > 0 {
+		_, warmup, _ := parseWarmup()
+		end = end.Add(warmup + rampUpFlag + durationFlag)
+	}
+	if msg := expiryWarning(pool.sessions, now, end); msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// expiryWarning returns a warning listing all the sessions whose token
+// expires before end, or the empty string if there are none.
+func expiryWarning(sessions []*session, now, end time.Time) string {
+	expiring := []string{}
+	for _, s := range sessions {
+		exp, ok := tokenExpiry(s.getToken())
+		if !ok || exp.After(end) {
+			continue
+		}
+		who := "the logged in user"
+		if s.username != "" {
+			who = s.username
+		}
+		if exp.Before(now) {
+			expiring = append(expiring, fmt.Sprintf("%s (expired at %s)", who, exp.Format(time.RFC3339)))
+		} else {
+			expiring = append(expiring, fmt.Sprintf("%s (expires at %s)", who, exp.Format(time.RFC3339)))
+		}
+	}
+	if len(expiring) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("The tokens of %s expire before the end of the benchmark and their requests will fail, use --relogin to renew them", strings.Join(expiring, ", "))
+}
+
+// tokenExpiry returns the expiration time in the claims of a JWT. It
+// returns false if token is not a JWT or it does not expire.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	claims := struct {
+		Exp float64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(b, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&usersFlag, "users", "", "CSV file with username,password pairs of the users the requests are distributed among. The default is the user logged in with login.")
+	RootCmd.PersistentFlags().BoolVar(&createHomesFlag, "create-homes", false, "Create the home directory of the users given with --users")
+	RootCmd.PersistentFlags().BoolVar(&reloginFlag, "relogin", false, "Login again when the server rejects a token, e.g. because it expired. The credentials of the user logged in with login are taken from the profile or from CLAWIO_BENCH_USERNAME and CLAWIO_BENCH_PASSWORD.")
+}
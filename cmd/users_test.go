@@ -0,0 +1,82 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jwt returns an unsigned JWT with the given claims.
+func jwt(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		token string
+		want  time.Time
+		ok    bool
+	}{
+		{jwt(`{"username":"alice","exp":1500000000}`), time.Unix(1500000000, 0), true},
+		{jwt(`{"exp":1.5e9}`), time.Unix(1500000000, 0), true},
+		// padded payload
+		{"e30." + base64.URLEncoding.EncodeToString([]byte(`{"exp":10}`)) + ".sig", time.Unix(10, 0), true},
+		{jwt(`{"username":"alice"}`), time.Time{}, false},
+		{jwt(`{"exp":0}`), time.Time{}, false},
+		{jwt(`{"exp":"tomorrow"}`), time.Time{}, false},
+		{jwt(`not json`), time.Time{}, false},
+		{"e30.!!!.sig", time.Time{}, false},
+		{"opaque-token", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tokenExpiry(tt.token)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("tokenExpiry(%q) = %v, %v, want %v, %v", tt.token, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExpiryWarning(t *testing.T) {
+	now := time.Unix(1000, 0)
+	end := now.Add(time.Hour)
+	sessions := []*session{
+		{username: "alice", token: jwt(`{"exp":900}`)},
+		{username: "bob", token: jwt(`{"exp":2000}`)},
+		{username: "carol", token: jwt(`{"exp":9000}`)},
+		{username: "dave", token: "opaque-token"},
+		{token: jwt(`{"exp":1500}`)},
+	}
+
+	msg := expiryWarning(sessions, now, end)
+	for _, who := range []string{"alice (expired at", "bob (expires at", "the logged in user (expires at"} {
+		if !strings.Contains(msg, who) {
+			t.Errorf("warning %q does not report %s", msg, who)
+		}
+	}
+	for _, who := range []string{"carol", "dave"} {
+		if strings.Contains(msg, who) {
+			t.Errorf("warning %q reports %s, whose token does not expire during the benchmark", msg, who)
+		}
+	}
+
+	if msg := expiryWarning(sessions[2:4], now, end); msg != "" {
+		t.Errorf("warning %q for tokens that do not expire during the benchmark", msg)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	pb "github.com/clawio/clawiobench/proto/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+// token is the owner and expiration of a token issued by the auth unit.
+type token struct {
+	user    string
+	expires time.Time
+}
+
+// Authenticate issues a token for valid credentials. Tokens are shaped like
+// the JWTs issued by ClawIO, with the username and, if Config.TokenTTL is
+// set, the expiration time in their claims, but they are not signed.
+func (s *Server) Authenticate(ctx context.Context, req *pb.AuthRequest) (*pb.AuthResponse, error) {
+	s.delay(ctx)
+	if err := s.grpcFault(); err != nil {
+		return nil, err
+	}
+
+	if len(s.config.Users) > 0 {
+		if pw, ok := s.config.Users[req.Username]; !ok || pw != req.Password {
+			return nil, grpc.Errorf(codes.Unauthenticated, "invalid credentials")
+		}
+	}
+
+	t := &token{user: req.Username}
+	claims := map[string]interface{}{"username": req.Username}
+	if s.config.TokenTTL > 0 {
+		t.expires = time.Now().Add(s.config.TokenTTL)
+		claims["exp"] = t.expires.Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enc := base64.RawURLEncoding
+	jwt := fmt.Sprintf("%s.%s.%x",
+		enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)),
+		enc.EncodeToString(payload),
+		s.rnd.Int63())
+	s.tokens[jwt] = t
+	return &pb.AuthResponse{Token: jwt}, nil
+}
+
+// user returns the owner of a valid token.
+func (s *Server) user(jwt string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[jwt]
+	if !ok || (!t.expires.IsZero() && time.Now().After(t.expires)) {
+		return "", false
+	}
+	return t.user, true
+}
@@ -0,0 +1,132 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeserver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"github.com/clawio/clawiobench/bench"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeHTTP implements the data unit: PUT uploads an object and GET
+// downloads it. The path of the URL is the path of the object. Faults are
+// injected before the token is checked.
+//
+// The checksum sent by uploads in the CIO-Checksum header, as algo:value,
+// is verified and kept as the checksum of the object. Objects uploaded
+// without checksum get their md5 checksum.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.delay(context.Background())
+	if s.httpFault(w, r) {
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	user, ok := s.user(token)
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	slow := s.roll(s.config.SlowBodyRate)
+	switch r.Method {
+	case "PUT":
+		if slow {
+			r.Body = ioutil.NopCloser(&slowReader{r: r.Body, delay: s.config.SlowBodyDelay})
+		}
+		s.put(w, r, user)
+	case "GET":
+		s.get(w, r, user, slow)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, user string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	checksum := r.Header.Get("CIO-Checksum")
+	if checksum == "" {
+		checksum = fmt.Sprintf("md5:%x", md5.Sum(data))
+	} else {
+		algo := strings.SplitN(checksum, ":", 2)[0]
+		computed, err := bench.Checksum(algo, bytes.NewReader(data))
+		if err != nil || computed == "" {
+			http.Error(w, "invalid checksum "+checksum, http.StatusBadRequest)
+			return
+		}
+		if computed != checksum {
+			http.Error(w, "checksum mismatch: computed "+computed, http.StatusPreconditionFailed)
+			return
+		}
+	}
+
+	switch {
+	case s.roll(s.config.TruncateRate):
+		data = data[:len(data)/2]
+	case len(data) > 0 && s.roll(s.config.CorruptRate):
+		data[0] ^= 0xff
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.lookup(user, r.URL.Path); ok && e.isContainer {
+		http.Error(w, "is a directory", http.StatusBadRequest)
+		return
+	}
+	p := cleanPath(r.URL.Path)
+	s.entries[key(user, p)] = &entry{
+		user:     user,
+		path:     p,
+		data:     data,
+		checksum: checksum,
+		modified: time.Now(),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, user string, slow bool) {
+	s.mu.Lock()
+	e, ok := s.lookup(user, r.URL.Path)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if e.isContainer {
+		http.Error(w, "is a directory", http.StatusBadRequest)
+		return
+	}
+
+	// data is never modified in place, so it can be written without the lock
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.data)))
+	if slow {
+		slowWrite(w, e.data, s.config.SlowBodyDelay)
+		return
+	}
+	w.Write(e.data)
+}
@@ -0,0 +1,160 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeserver implements in-process stand-ins for the ClawIO auth,
+// meta and data units. They keep everything in memory and can add latency
+// and inject errors, which makes it possible to exercise clawiobench
+// without a ClawIO deployment.
+package fakeserver
+
+import (
+	"crypto/tls"
+	authpb "github.com/clawio/clawiobench/proto/auth"
+	metapb "github.com/clawio/clawiobench/proto/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Config controls the behaviour of the fake servers. All the rates are
+// fractions of requests between 0 and 1.
+type Config struct {
+	// Users maps usernames to passwords. When empty any credentials are
+	// accepted.
+	Users map[string]string
+	// TokenTTL is the lifetime of the issued tokens. They never expire if
+	// it is zero.
+	TokenTTL time.Duration
+	// TLS is the configuration of the units when they are served over TLS.
+	// They are served in plain text if it is nil.
+	TLS *tls.Config
+
+	// Latency is the mean latency added to the handling of every request.
+	Latency time.Duration
+	// LatencyDistribution is the distribution of the latency: "constant"
+	// (the default), "uniform" in [Latency-LatencySpread,
+	// Latency+LatencySpread], "normal" with LatencySpread as standard
+	// deviation or "exponential".
+	LatencyDistribution string
+	LatencySpread       time.Duration
+
+	// ErrorRate is the rate of requests that fail with an internal error:
+	// codes.Internal or HTTP 500.
+	ErrorRate float64
+	// UnavailableRate is the rate of gRPC requests that fail with
+	// codes.Unavailable.
+	UnavailableRate float64
+	// UnauthenticatedRate is the rate of requests rejected as if the token
+	// or the credentials were invalid: codes.Unauthenticated or HTTP 401.
+	UnauthenticatedRate float64
+	// InsufficientStorageRate is the rate of uploads that fail with HTTP
+	// 507.
+	InsufficientStorageRate float64
+	// ResetRate is the rate of HTTP requests whose connection is reset
+	// without response.
+	ResetRate float64
+	// TruncateRate is the rate of uploads of which only the first half is
+	// stored, and CorruptRate the rate of uploads stored with their first
+	// byte altered. Both are answered as successful.
+	TruncateRate float64
+	CorruptRate  float64
+	// SlowBodyRate is the rate of HTTP requests whose body is transferred
+	// in chunks of SlowBodyChunk bytes with a pause of SlowBodyDelay
+	// between them.
+	SlowBodyRate  float64
+	SlowBodyDelay time.Duration
+}
+
+// SlowBodyChunk is the size of the chunks of slow bodies.
+const SlowBodyChunk = 64 * 1024
+
+// Latency distributions.
+const (
+	Constant    = "constant"
+	Uniform     = "uniform"
+	Normal      = "normal"
+	Exponential = "exponential"
+)
+
+// Server implements the auth, meta and data units of ClawIO.
+type Server struct {
+	config Config
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	tokens  map[string]*token
+	entries map[string]*entry
+}
+
+// New returns a server with an empty namespace.
+func New(config Config) *Server {
+	return &Server{
+		config:  config,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		tokens:  map[string]*token{},
+		entries: map[string]*entry{},
+	}
+}
+
+// Serve serves the auth and meta units with gRPC and the data unit with
+// HTTP on the given listeners. It blocks until one of them fails.
+func (s *Server) Serve(authLis, metaLis, dataLis net.Listener) error {
+	errs := make(chan error, 3)
+
+	opts := []grpc.ServerOption{}
+	if s.config.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.config.TLS)))
+		dataLis = tls.NewListener(dataLis, s.config.TLS)
+	}
+
+	authSrv := grpc.NewServer(opts...)
+	authpb.RegisterAuthServer(authSrv, s)
+	go func() { errs <- authSrv.Serve(authLis) }()
+
+	metaSrv := grpc.NewServer(opts...)
+	metapb.RegisterMetaServer(metaSrv, s)
+	go func() { errs <- metaSrv.Serve(metaLis) }()
+
+	go func() { errs <- http.Serve(dataLis, s) }()
+
+	err := <-errs
+	authSrv.Stop()
+	metaSrv.Stop()
+	dataLis.Close()
+	return err
+}
+
+// ListenAndServe listens on the given TCP addresses and calls Serve.
+func (s *Server) ListenAndServe(authAddr, metaAddr, dataAddr string) error {
+	authLis, err := net.Listen("tcp", authAddr)
+	if err != nil {
+		return err
+	}
+	metaLis, err := net.Listen("tcp", metaAddr)
+	if err != nil {
+		authLis.Close()
+		return err
+	}
+	dataLis, err := net.Listen("tcp", dataAddr)
+	if err != nil {
+		authLis.Close()
+		metaLis.Close()
+		return err
+	}
+	return s.Serve(authLis, metaLis, dataLis)
+}
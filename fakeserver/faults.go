@@ -0,0 +1,156 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeserver
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// latency returns the latency to add to a request.
+func (s *Server) latency() time.Duration {
+	mean := s.config.Latency
+	spread := s.config.LatencySpread
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var d time.Duration
+	switch s.config.LatencyDistribution {
+	case Uniform:
+		d = mean - spread + time.Duration(s.rnd.Float64()*float64(2*spread))
+	case Normal:
+		d = mean + time.Duration(s.rnd.NormFloat64()*float64(spread))
+	case Exponential:
+		d = time.Duration(s.rnd.ExpFloat64() * float64(mean))
+	default:
+		d = mean
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// delay waits for the latency of a request or until ctx is done.
+func (s *Server) delay(ctx context.Context) {
+	d := s.latency()
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// roll tells whether a fault injected with the given rate happens.
+func (s *Server) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < rate
+}
+
+// grpcFault returns the error injected into a gRPC request, if any.
+func (s *Server) grpcFault() error {
+	switch {
+	case s.roll(s.config.ErrorRate):
+		return grpc.Errorf(codes.Internal, "injected error")
+	case s.roll(s.config.UnavailableRate):
+		return grpc.Errorf(codes.Unavailable, "injected unavailability")
+	case s.roll(s.config.UnauthenticatedRate):
+		return grpc.Errorf(codes.Unauthenticated, "injected invalid credentials")
+	}
+	return nil
+}
+
+// httpFault injects a fault into an HTTP request. It returns true if the
+// request has been answered.
+func (s *Server) httpFault(w http.ResponseWriter, r *http.Request) bool {
+	switch {
+	case s.roll(s.config.ResetRate):
+		reset(w)
+	case s.roll(s.config.ErrorRate):
+		http.Error(w, "injected error", http.StatusInternalServerError)
+	case s.roll(s.config.UnauthenticatedRate):
+		http.Error(w, "injected invalid token", http.StatusUnauthorized)
+	case r.Method == "PUT" && s.roll(s.config.InsufficientStorageRate):
+		// http.StatusInsufficientStorage is not defined before Go 1.7
+		http.Error(w, "injected insufficient storage", 507)
+	default:
+		return false
+	}
+	return true
+}
+
+// reset closes the connection of w without sending a response. TCP
+// connections are closed with an RST.
+func reset(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("the connection cannot be reset")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// slowReader pauses before reading every chunk of the wrapped reader.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	if len(p) > SlowBodyChunk {
+		p = p[:SlowBodyChunk]
+	}
+	return s.r.Read(p)
+}
+
+// slowWrite writes data to w in chunks pausing between them.
+func slowWrite(w http.ResponseWriter, data []byte, delay time.Duration) {
+	flusher, _ := w.(http.Flusher)
+	for len(data) > 0 {
+		n := SlowBodyChunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		data = data[n:]
+		if len(data) > 0 {
+			time.Sleep(delay)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeserver
+
+import (
+	"crypto/md5"
+	"fmt"
+	pb "github.com/clawio/clawiobench/proto/metadata"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+// authorize returns the owner of token after applying the latency and the
+// error injection.
+func (s *Server) authorize(ctx context.Context, token string) (string, error) {
+	s.delay(ctx)
+	if err := s.grpcFault(); err != nil {
+		return "", err
+	}
+	user, ok := s.user(token)
+	if !ok {
+		return "", grpc.Errorf(codes.Unauthenticated, "invalid token")
+	}
+	return user, nil
+}
+
+// Home creates the home directory of the user.
+func (s *Server) Home(ctx context.Context, req *pb.HomeReq) (*pb.Void, error) {
+	if _, err := s.authorize(ctx, req.AccessToken); err != nil {
+		return nil, err
+	}
+	return &pb.Void{}, nil
+}
+
+// Mkdir creates a directory.
+func (s *Server) Mkdir(ctx context.Context, req *pb.MkdirReq) (*pb.Void, error) {
+	user, err := s.authorize(ctx, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(user, req.Path); ok {
+		return nil, grpc.Errorf(codes.AlreadyExists, "%s already exists", req.Path)
+	}
+	p := cleanPath(req.Path)
+	s.entries[key(user, p)] = &entry{user: user, path: p, isContainer: true, modified: time.Now()}
+	return &pb.Void{}, nil
+}
+
+// Stat returns the metadata of a resource and optionally of its children.
+func (s *Server) Stat(ctx context.Context, req *pb.StatReq) (*pb.Metadata, error) {
+	user, err := s.authorize(ctx, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(user, req.Path)
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "%s not found", req.Path)
+	}
+	meta := e.metadata()
+	if req.Children && e.isContainer {
+		for _, c := range s.children(user, e.path) {
+			meta.Children = append(meta.Children, c.metadata())
+		}
+	}
+	return meta, nil
+}
+
+// Cp copies a resource and its descendants.
+func (s *Server) Cp(ctx context.Context, req *pb.CpReq) (*pb.Void, error) {
+	user, err := s.authorize(ctx, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(user, req.Src); !ok {
+		return nil, grpc.Errorf(codes.NotFound, "%s not found", req.Src)
+	}
+	for _, e := range s.tree(user, req.Src) {
+		c := *e
+		c.path = rebase(e.path, req.Src, req.Dst)
+		c.modified = time.Now()
+		s.entries[key(user, c.path)] = &c
+	}
+	return &pb.Void{}, nil
+}
+
+// Mv renames a resource and its descendants.
+func (s *Server) Mv(ctx context.Context, req *pb.MvReq) (*pb.Void, error) {
+	user, err := s.authorize(ctx, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(user, req.Src); !ok {
+		return nil, grpc.Errorf(codes.NotFound, "%s not found", req.Src)
+	}
+	for _, e := range s.tree(user, req.Src) {
+		delete(s.entries, key(user, e.path))
+		e.path = rebase(e.path, req.Src, req.Dst)
+		s.entries[key(user, e.path)] = e
+	}
+	return &pb.Void{}, nil
+}
+
+// Rm removes a resource and its descendants.
+func (s *Server) Rm(ctx context.Context, req *pb.RmReq) (*pb.Void, error) {
+	user, err := s.authorize(ctx, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(user, req.Path); !ok {
+		return nil, grpc.Errorf(codes.NotFound, "%s not found", req.Path)
+	}
+	for _, e := range s.tree(user, req.Path) {
+		delete(s.entries, key(user, e.path))
+	}
+	return &pb.Void{}, nil
+}
+
+func (e *entry) metadata() *pb.Metadata {
+	return &pb.Metadata{
+		Id:          fmt.Sprintf("%x", md5.Sum([]byte(e.user+e.path))),
+		Path:        e.path,
+		Size:        uint32(len(e.data)),
+		IsContainer: e.isContainer,
+		MimeType:    "application/octet-stream",
+		Checksum:    e.checksum,
+		Modified:    uint32(e.modified.Unix()),
+		Etag:        fmt.Sprintf("%x", e.modified.UnixNano()),
+		Permissions: 0755,
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright © 2015 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeserver
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// entry is a file or directory of the namespace.
+type entry struct {
+	user        string
+	path        string
+	isContainer bool
+	data        []byte
+	checksum    string
+	modified    time.Time
+}
+
+// key returns the key of the entry of user at p.
+func key(user, p string) string {
+	return user + ":" + cleanPath(p)
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// lookup returns the entry of user at p. The root always exists. The caller
+// must hold s.mu.
+func (s *Server) lookup(user, p string) (*entry, bool) {
+	p = cleanPath(p)
+	if e, ok := s.entries[key(user, p)]; ok {
+		return e, true
+	}
+	if p == "/" {
+		return &entry{user: user, path: "/", isContainer: true}, true
+	}
+	return nil, false
+}
+
+// tree returns the entry of user at p and all its descendants. The caller
+// must hold s.mu.
+func (s *Server) tree(user, p string) []*entry {
+	p = cleanPath(p)
+	prefix := key(user, p)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	entries := []*entry{}
+	for k, e := range s.entries {
+		if k == key(user, p) || strings.HasPrefix(k, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// children returns the direct children of the entry of user at p. The
+// caller must hold s.mu.
+func (s *Server) children(user, p string) []*entry {
+	p = cleanPath(p)
+	entries := []*entry{}
+	for _, e := range s.entries {
+		if e.user == user && e.path != p && path.Dir(e.path) == p {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// rebase returns p with the prefix src replaced by dst.
+func rebase(p, src, dst string) string {
+	return cleanPath(dst + strings.TrimPrefix(p, cleanPath(src)))
+}